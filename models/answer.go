@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Answer is the answer to a form item. Most form items have one value,
+// a checkboxes item has the options that were ticked, which can be none.
+// In responses.formvalues json a one value answer is a string, as it was
+// before there were multi valued answers, and other answers are arrays
+// e.g. ["Lam", ["Chicken", "Fish"], "✅"]
+type Answer []string
+
+// String is the values one per line
+func (a Answer) String() string {
+	return strings.Join(a, "\n")
+}
+
+// MarshalJSON a one value answer as a string, others as an array
+func (a Answer) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	if a == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON an answer from a string or an array of strings
+func (a *Answer) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = Answer{s}
+		return nil
+	}
+	var values []string
+	if err := json.Unmarshal(b, &values); err != nil {
+		return err
+	}
+	*a = Answer(values)
+	return nil
+}
@@ -0,0 +1,267 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// dialect is the part of the sql that is different for each database driver
+// queries are written with ? placeholders and rebound to the dialect
+type dialect struct {
+	// name is also the directory of the dialect's migrations
+	name string
+	// placeholder is the nth bind parameter, nil keeps the ? (mysql, sqlite)
+	placeholder func(n int) string
+	// returning gets new row ids with INSERT ... RETURNING id
+	// for drivers that do not support LastInsertId (postgres)
+	returning bool
+	// duplicate reports if err is from inserting a duplicate primary/unique key
+	duplicate func(err error) bool
+	// ignoreDuplicate is added to an INSERT to do nothing if the key exists
+	// instead of failing, a failed statement ends a postgres transaction
+	ignoreDuplicate string
+	// answer is the text of the nth answer of the formvalues json array
+	// of a response, an answer of more than one value is its json text
+	answer func(n int) string
+	// number is the text expression as a number to sort by
+	number func(expr string) string
+	// search is the condition that the searchtext of a response has a
+	// word starting with each of the words (see SearchWords) and its args
+	search func(words []string) (cond string, args []interface{})
+}
+
+var mysqlDialect = dialect{
+	name: "mysql",
+	duplicate: func(err error) bool {
+		// Error 1062: Duplicate entry 'xyz' for key 'users.name'
+		var e *mysql.MySQLError
+		return errors.As(err, &e) && e.Number == 1062
+	},
+	// INSERT IGNORE would also ignore other errors e.g. data too long
+	ignoreDuplicate: "ON DUPLICATE KEY UPDATE formid=formid",
+	answer: func(n int) string {
+		return fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(formvalues, '$[%d]'))", n)
+	},
+	number: func(expr string) string {
+		return "(" + expr + " + 0)"
+	},
+	search: func(words []string) (string, []interface{}) {
+		// +word* is a word that must start with word. The full-text index
+		// has no words shorter than innodb_ft_min_token_size or stopwords
+		// so these are found with a regexp (mysql 8) of the searchtext
+		var match, conds []string
+		var args []interface{}
+		for _, word := range words {
+			if utf8.RuneCountInString(word) < mysqlMinToken || mysqlStopwords[word] {
+				conds = append(conds, "REGEXP_LIKE(searchtext, ?, 'i')")
+				args = append(args, `(^|[^\p{L}\p{N}])`+word)
+				continue
+			}
+			match = append(match, "+"+word+"*")
+		}
+		if len(match) != 0 {
+			conds = append([]string{"MATCH(searchtext) AGAINST (? IN BOOLEAN MODE)"}, conds...)
+			args = append([]interface{}{strings.Join(match, " ")}, args...)
+		}
+		return strings.Join(conds, " AND "), args
+	},
+}
+
+// mysqlMinToken is the default innodb_ft_min_token_size, the shortest
+// word in a FULLTEXT index
+const mysqlMinToken = 3
+
+// mysqlStopwords are the default stopwords of innodb (INNODB_FT_DEFAULT_STOPWORD)
+// that are not shorter than mysqlMinToken, they are not in a FULLTEXT index
+var mysqlStopwords = map[string]bool{
+	"about": true, "are": true, "com": true, "for": true, "from": true, "how": true,
+	"that": true, "the": true, "this": true, "und": true, "was": true, "what": true,
+	"when": true, "where": true, "who": true, "will": true, "with": true, "www": true,
+}
+
+var sqliteDialect = dialect{
+	name: "sqlite",
+	duplicate: func(err error) bool {
+		var e *sqlite.Error
+		if !errors.As(err, &e) {
+			return false
+		}
+		return e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || e.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	},
+	ignoreDuplicate: "ON CONFLICT DO NOTHING",
+	answer: func(n int) string {
+		return fmt.Sprintf("json_extract(formvalues, '$[%d]')", n)
+	},
+	number: func(expr string) string {
+		return "CAST(" + expr + " AS REAL)"
+	},
+	search: func(words []string) (string, []interface{}) {
+		// the words are quoted as AND, OR and NOT are operators
+		return "id IN (SELECT rowid FROM responses_search WHERE responses_search MATCH ?)", []interface{}{`"` + strings.Join(words, `"* "`) + `"*`}
+	},
+}
+
+var postgresDialect = dialect{
+	name: "postgres",
+	placeholder: func(n int) string {
+		return "$" + strconv.Itoa(n)
+	},
+	returning: true,
+	duplicate: func(err error) bool {
+		// 23505 unique_violation
+		var e *pq.Error
+		return errors.As(err, &e) && e.Code == "23505"
+	},
+	ignoreDuplicate: "ON CONFLICT DO NOTHING",
+	answer: func(n int) string {
+		return fmt.Sprintf("(formvalues::jsonb->>%d)", n)
+	},
+	number: func(expr string) string {
+		// a cast of text that is not a number fails, {0,1} as a ? would be rebound
+		return "CASE WHEN " + expr + ` ~ '^[-+]{0,1}([0-9]+[.]{0,1}[0-9]*|[.][0-9]+)([eE][-+]{0,1}[0-9]+){0,1}$' THEN CAST(` + expr + " AS DOUBLE PRECISION) END"
+	},
+	search: func(words []string) (string, []interface{}) {
+		// the expression of the responses_search index
+		return "to_tsvector('simple', COALESCE(searchtext, '')) @@ to_tsquery('simple', ?)", []interface{}{strings.Join(words, ":* & ") + ":*"}
+	},
+}
+
+// rebind replaces the ? placeholders in q with the dialect's placeholders
+func (d dialect) rebind(q string) string {
+	if d.placeholder == nil {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			b.WriteString(d.placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlDB is the database handle shared by FormDB, UserDB and ResponseDB
+// its Exec, Query and QueryRow rebind the queries to the dialect
+type sqlDB struct {
+	*sql.DB
+	dialect
+}
+
+func (db sqlDB) Exec(q string, args ...interface{}) (sql.Result, error) {
+	return db.DB.Exec(db.rebind(q), args...)
+}
+
+func (db sqlDB) Query(q string, args ...interface{}) (*sql.Rows, error) {
+	return db.DB.Query(db.rebind(q), args...)
+}
+
+func (db sqlDB) QueryRow(q string, args ...interface{}) *sql.Row {
+	return db.DB.QueryRow(db.rebind(q), args...)
+}
+
+// inTx runs fn in a transaction which is committed if fn returns nil
+// or rolled back if fn returns an error (or panics)
+// sqlite has one connection so fn must only use tx, not db
+func (db sqlDB) inTx(fn func(tx sqlTx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+	if err = fn(sqlTx{tx, db.dialect}); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%v (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlTx is a transaction, its Exec, Query and QueryRow rebind like sqlDB
+type sqlTx struct {
+	*sql.Tx
+	dialect
+}
+
+func (tx sqlTx) Exec(q string, args ...interface{}) (sql.Result, error) {
+	return tx.Tx.Exec(tx.rebind(q), args...)
+}
+
+func (tx sqlTx) Query(q string, args ...interface{}) (*sql.Rows, error) {
+	return tx.Tx.Query(tx.rebind(q), args...)
+}
+
+func (tx sqlTx) QueryRow(q string, args ...interface{}) *sql.Row {
+	return tx.Tx.QueryRow(tx.rebind(q), args...)
+}
+
+// querier is a sqlDB or sqlTx
+type querier interface {
+	Exec(q string, args ...interface{}) (sql.Result, error)
+	QueryRow(q string, args ...interface{}) *sql.Row
+}
+
+// insert runs the INSERT query q and returns the id of the new row
+func (db sqlDB) insert(q string, args ...interface{}) (int, error) {
+	return insertID(db, db.returning, q, args...)
+}
+
+// insert runs the INSERT query q and returns the id of the new row
+func (tx sqlTx) insert(q string, args ...interface{}) (int, error) {
+	return insertID(tx, tx.returning, q, args...)
+}
+
+func insertID(db querier, returning bool, q string, args ...interface{}) (int, error) {
+	if returning {
+		id := 0
+		err := db.QueryRow(q+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	r, err := db.Exec(q, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := r.LastInsertId()
+	return int(id), err
+}
+
+const timeLayout = "2006-01-02 15:04:05"
+
+// timestamp scans a datetime column to the same string for every driver
+// mysql gives []byte "2006-01-02 15:04:05", sqlite and postgres give time.Time
+type timestamp string
+
+func (t *timestamp) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*t = timestamp(v.Format(timeLayout))
+	case []byte:
+		*t = timestamp(v)
+	case string:
+		*t = timestamp(v)
+	case nil:
+		*t = ""
+	default:
+		return fmt.Errorf("cannot scan %T into timestamp", src)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Change is a field that is different between two revisions of a form
+type Change struct {
+	Field string // e.g. Title, Item 2 Label
+	Old   string
+	New   string
+}
+
+// the fields of a form item that are compared in a diff
+var itemFields = []struct {
+	name  string
+	value func(FormItem) string
+}{
+	{"Label", func(f FormItem) string { return f.Label }},
+	{"Type", func(f FormItem) string { return f.Type }},
+	{"Options", func(f FormItem) string { return strings.Join(f.Options, ", ") }},
+	{"Rules", func(f FormItem) string { return f.Rules.String() }},
+	{"Show", func(f FormItem) string { return f.Show.String() }},
+	{"Help", func(f FormItem) string { return f.Help }},
+	{"Placeholder", func(f FormItem) string { return f.Placeholder }},
+	{"Default", func(f FormItem) string { return f.Default }},
+	{"Key", func(f FormItem) string { return f.Key }},
+	{"Prefill", func(f FormItem) string { return f.Prefill }},
+}
+
+// Diff lists the field level changes from revision a to revision b. The
+// form items are matched by id, an item is named by its place in b, or in
+// a if it was removed e.g. Item 2 Label. Revisions saved before the items
+// had ids are compared by position
+func Diff(a, b Revision) (changes []Change) {
+	if a.Title != b.Title {
+		changes = append(changes, Change{"Title", a.Title, b.Title})
+	}
+	if !haveIDs(a.FormItems) || !haveIDs(b.FormItems) {
+		return append(changes, diffByPosition(a.FormItems, b.FormItems)...)
+	}
+	at := map[string]int{} // the place of each item of a
+	for i, item := range a.FormItems {
+		at[item.ID] = i
+	}
+	kept := keptInOrder(a.FormItems, b.FormItems)
+	inB := map[string]bool{}
+	for j, item := range b.FormItems {
+		inB[item.ID] = true
+		name := "Item " + strconv.Itoa(j+1)
+		i, ok := at[item.ID]
+		if !ok {
+			changes = append(changes, Change{name + " added", "", describe(item)})
+			continue
+		}
+		if !kept[item.ID] {
+			changes = append(changes, Change{name + " moved", "item " + strconv.Itoa(i+1), "item " + strconv.Itoa(j+1)})
+		}
+		changes = append(changes, diffItem(name, a.FormItems[i], item)...)
+	}
+	for i, item := range a.FormItems {
+		if !inB[item.ID] {
+			changes = append(changes, Change{"Item " + strconv.Itoa(i+1) + " removed", describe(item), ""})
+		}
+	}
+	return changes
+}
+
+// diffByPosition compares the form items by position, Item 1 is the
+// first item
+func diffByPosition(a, b []FormItem) (changes []Change) {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		item := "Item " + strconv.Itoa(i+1)
+		switch {
+		case i >= len(a):
+			changes = append(changes, Change{item + " added", "", describe(b[i])})
+		case i >= len(b):
+			changes = append(changes, Change{item + " removed", describe(a[i]), ""})
+		default:
+			changes = append(changes, diffItem(item, a[i], b[i])...)
+		}
+	}
+	return changes
+}
+
+// diffItem is the changes of the fields of the form item named item
+func diffItem(item string, a, b FormItem) (changes []Change) {
+	for _, field := range itemFields {
+		old, new := field.value(a), field.value(b)
+		if old != new {
+			changes = append(changes, Change{item + " " + field.name, old, new})
+		}
+	}
+	return changes
+}
+
+// haveIDs is if all the form items have an id
+func haveIDs(formItems []FormItem) bool {
+	for _, item := range formItems {
+		if item.ID == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// keptInOrder are the ids of the most items of both a and b that are in
+// the same order in both (the longest common subsequence), the other
+// items of both were moved
+func keptInOrder(a, b []FormItem) map[string]bool {
+	// n[i][j] is the most items of a[i:] and b[j:] in the same order
+	n := make([][]int, len(a)+1)
+	for i := range n {
+		n[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i].ID == b[j].ID {
+				n[i][j] = n[i+1][j+1] + 1
+			} else {
+				n[i][j] = max(n[i+1][j], n[i][j+1])
+			}
+		}
+	}
+	kept := map[string]bool{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i].ID == b[j].ID:
+			kept[a[i].ID] = true
+			i++
+			j++
+		case n[i+1][j] >= n[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return kept
+}
+
+// describe a form item in a line e.g. Order (select: Chicken, Fish)
+func describe(f FormItem) string {
+	s := f.Label + " (" + f.Type
+	if len(f.Options) != 0 {
+		s += ": " + strings.Join(f.Options, ", ")
+	}
+	return s + ")"
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileStore is the storage for the files uploaded with form responses
+// keys are slash separated paths e.g. 4/<uuid>/menu.pdf
+// Get of a key that is not found returns an error that is fs.ErrNotExist
+type FileStore interface {
+	Put(key string, r io.Reader) error
+	Get(key string) (io.ReadCloser, error)
+	// Delete the file, or all the files under key/ e.g. 4 is all of form 4
+	Delete(key string) error
+}
+
+// LocalFiles keeps the files in a directory of the local filesystem
+type LocalFiles struct {
+	dir string
+}
+
+// NewLocalFiles keeps the files in dir, which is created if not found
+func NewLocalFiles(dir string) (LocalFiles, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return LocalFiles{}, err
+	}
+	return LocalFiles{dir}, nil
+}
+
+// path of the file, keys cannot be outside of the dir e.g. ../x
+func (f LocalFiles) path(key string) (string, error) {
+	if !fs.ValidPath(key) || key == "." {
+		return "", fmt.Errorf("invalid file key: %q", key)
+	}
+	return filepath.Join(f.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file to a temporary file which is renamed when done
+// so a failed upload does not leave part of a file
+func (f LocalFiles) Put(key string, r io.Reader) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // fails after the rename, which is fine
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Get opens the file
+func (f LocalFiles) Get(key string) (io.ReadCloser, error) {
+	p, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+// Delete the file or the directory of files
+func (f LocalFiles) Delete(key string) error {
+	p, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+// memFiles keeps the files in memory, for tests and demo mode
+type memFiles struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemFiles keeps the files in memory, they are lost when the server stops
+func NewMemFiles() FileStore {
+	return &memFiles{files: map[string][]byte{}}
+}
+
+func (f *memFiles) Put(key string, r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.files[key] = b
+	return nil
+}
+
+func (f *memFiles) Get(key string) (io.ReadCloser, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	b, ok := f.files[key]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: key, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (f *memFiles) Delete(key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for k := range f.files {
+		if k == key || strings.HasPrefix(k, key+"/") {
+			delete(f.files, k)
+		}
+	}
+	return nil
+}
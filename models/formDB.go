@@ -6,19 +6,10 @@ import (
 	"errors"
 )
 
-// mysql statement to create the table:
-//
-// CREATE TABLE `forms` (
-// 	`id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
-// 	`title` char(50) NOT NULL,
-// 	`formitems` text NOT NULL,
-// 	`updated` datetime NOT NULL,
-// 	`userid` int NOT NULL
-// );
-
 // FormDB is the database handle with functions to access forms table
+// the tables are created by the sql in migrations/<driver>
 type FormDB struct {
-	*sql.DB
+	sqlDB
 }
 
 // GetAll forms belonging to the user
@@ -32,7 +23,7 @@ func (db FormDB) GetAll(userid int) (forms []Form, err error) {
 
 	for rows.Next() {
 		form := Form{}
-		err = rows.Scan(&form.ID, &form.Title, &form.Updated)
+		err = rows.Scan(&form.ID, &form.Title, (*timestamp)(&form.Updated))
 		if err != nil {
 			return nil, err
 		}
@@ -60,7 +51,7 @@ func (db FormDB) Use(id int) (title, updated string, formItems []FormItem, found
 func (db FormDB) get(q string, ids ...interface{}) (title, updated string, formItems []FormItem, found bool, err error) {
 	formItemsJSON := ""
 	row := db.QueryRow(q, ids...)
-	err = row.Scan(&title, &formItemsJSON, &updated)
+	err = row.Scan(&title, &formItemsJSON, (*timestamp)(&updated))
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
 			return
@@ -77,73 +68,94 @@ func (db FormDB) get(q string, ids ...interface{}) (title, updated string, formI
 	return
 }
 
-// New creates a new form belonging to the user
-func (db FormDB) New(userid int) (id int, err error) {
-	newFormItemsJSON := `[{"Label":"Text box","Type":"text","Options":null},{"Label":"Check box","Type":"checkbox","Options":null},{"Label":"Drop down select","Type":"select","Options":["option1","option2"]}]`
+// the title and form items of a new form
+const newFormTitle = "New Form"
+
+var newFormItems = []FormItem{
+	{Label: "Text box", Type: "text"},
+	{Label: "Check box", Type: "checkbox"},
+	{Label: "Drop down select", Type: "select", Options: []string{"option1", "option2"}},
+}
 
-	q := `INSERT INTO forms (title, formitems, updated, userid) VALUES ("New Form", ?, NOW(), ?)`
-	r, err := db.Exec(q, newFormItemsJSON, userid)
+// New creates a new form belonging to the user, which is its first revision
+func (db FormDB) New(userid int) (id int, err error) {
+	formItemsJSON, err := newFormItemsJSON()
 	if err != nil {
 		return 0, err
 	}
-	formID, err := r.LastInsertId()
+	err = db.inTx(func(tx sqlTx) error {
+		q := `INSERT INTO forms (title, formitems, updated, userid) VALUES (?, ?, CURRENT_TIMESTAMP, ?)`
+		id, err = tx.insert(q, newFormTitle, formItemsJSON, userid)
+		if err != nil {
+			return err
+		}
+		return newRevision(tx, id)
+	})
 	if err != nil {
 		return 0, err
 	}
-	return int(formID), nil
+	return id, nil
 }
 
-// Delete form belonging to the user
+// Delete form belonging to the user, and its revisions and responses
+// all in a transaction so there are no responses left without a form
 func (db FormDB) Delete(id, userid int) error {
-	q := `DELETE FROM forms WHERE id=? AND userid=?`
-	result, err := db.Exec(q, id, userid)
-	if err != nil {
-		return err
-	}
-	// also must remove responses if any
-	// do it as a transaction??
-	if num, _ := result.RowsAffected(); num == 1 {
+	return db.inTx(func(tx sqlTx) error {
+		q := `DELETE FROM forms WHERE id=? AND userid=?`
+		result, err := tx.Exec(q, id, userid)
+		if err != nil {
+			return err
+		}
+		num, err := result.RowsAffected()
+		if err != nil || num == 0 {
+			return err
+		}
 		qq := []string{
+			`DELETE FROM revisions WHERE formid=?`,
 			`DELETE FROM versions WHERE formid=?`,
 			`DELETE FROM responses WHERE formid=?`,
 		}
 		for _, q = range qq {
-			_, err := db.Exec(q, id)
-			if err != nil {
+			if _, err = tx.Exec(q, id); err != nil {
 				return err
 			}
-
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
-// Update form belonging to the user
+// Update form belonging to the user, each update is saved as a revision
+// form items without an id are given a new one
 func (db FormDB) Update(id, userid int, title string, formItems []FormItem) error {
-	b, err := json.Marshal(formItems)
+	b, err := json.Marshal(withItemIDs(formItems))
 	if err != nil {
 		return err
 	}
 	formItemsJSON := string(b)
 
-	oldTitle, oldFormItemsJSON := "", ""
-	q := `SELECT title, formitems FROM forms WHERE id=?`
-	row := db.QueryRow(q, id)
-	err = row.Scan(&oldTitle, &oldFormItemsJSON)
-	if err != nil {
-		return err
-	}
-	// if no change to title and formItems do not update
-	if title == oldTitle && formItemsJSON == oldFormItemsJSON {
-		return nil
-	}
+	return db.inTx(func(tx sqlTx) error {
+		oldTitle, oldFormItemsJSON := "", ""
+		q := `SELECT title, formitems FROM forms WHERE id=?`
+		row := tx.QueryRow(q, id)
+		err := row.Scan(&oldTitle, &oldFormItemsJSON)
+		if err != nil {
+			return err
+		}
+		// if no change to title and formItems do not update
+		if title == oldTitle && formItemsJSON == oldFormItemsJSON {
+			return nil
+		}
 
-	q = `UPDATE forms SET title=?, formitems=?, updated=NOW() WHERE id=? AND userid=?`
-	_, err = db.Exec(q, title, formItemsJSON, id, userid)
-	if err != nil {
-		return err
-	}
-	return nil
+		q = `UPDATE forms SET title=?, formitems=?, updated=CURRENT_TIMESTAMP WHERE id=? AND userid=?`
+		result, err := tx.Exec(q, title, formItemsJSON, id, userid)
+		if err != nil {
+			return err
+		}
+		if num, err := result.RowsAffected(); err != nil || num == 0 {
+			return err
+		}
+		return newRevision(tx, id)
+	})
 }
 
 // Check if form belongs to user
@@ -0,0 +1,237 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+)
+
+// form items have an id that stays the same when the item is renamed,
+// moved or its type changed. The answers of a version of the form are
+// kept with the ids of its items, so the answers to an item can be
+// followed across the versions of the form
+
+// itemIDPattern is 8 hex digits e.g. 9f86d081, unlike the other names
+// posted by the use page e.g. version, page, file9f86d081
+var itemIDPattern = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+// ValidItemID is if id is a form item id
+func ValidItemID(id string) bool {
+	return itemIDPattern.MatchString(id)
+}
+
+// NewItemID is a new random id that is not the id of any of the form items
+func NewItemID(formItems []FormItem) string {
+	b := make([]byte, 4)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(err) // the system's random source is broken
+		}
+		id := hex.EncodeToString(b)
+		used := false
+		for _, formItem := range formItems {
+			used = used || formItem.ID == id
+		}
+		if !used {
+			return id
+		}
+	}
+}
+
+// withItemIDs is a copy of the form items where the items without an id
+// have a new one, so every stored form item has an id
+func withItemIDs(formItems []FormItem) []FormItem {
+	items := append([]FormItem(nil), formItems...)
+	for i := range items {
+		if items[i].ID == "" {
+			items[i].ID = NewItemID(items)
+		}
+	}
+	return items
+}
+
+// newFormItemsJSON is the form items of a new form, with new ids
+func newFormItemsJSON() (string, error) {
+	b, err := json.Marshal(withItemIDs(newFormItems))
+	return string(b), err
+}
+
+// matchItemIDs gives the form items without an id the id of the item with
+// the same label in prev, e.g. the revision before, or else a new id
+func matchItemIDs(formItems, prev []FormItem) {
+	taken := map[string]bool{}
+	for _, formItem := range formItems {
+		taken[formItem.ID] = true
+	}
+	for i := range formItems {
+		if formItems[i].ID != "" {
+			continue
+		}
+		for _, p := range prev {
+			if p.Label != "" && p.Label == formItems[i].Label && !taken[p.ID] {
+				formItems[i].ID = p.ID
+				break
+			}
+		}
+		if formItems[i].ID == "" {
+			formItems[i].ID = NewItemID(append(append([]FormItem(nil), formItems...), prev...))
+		}
+		taken[formItems[i].ID] = true
+	}
+}
+
+// hasAnswer is if the form item is a column of the responses
+// the items without a label and the sections have no answer
+func hasAnswer(formItem FormItem) bool {
+	return formItem.Label != "" && formItem.Type != "section"
+}
+
+// versionItemIDs are the ids of the answers of a version with keys (the
+// labels of its answers) that was made from formItems. The form items are
+// the revision of the version, or the form if the revision is not found
+// which are matched by label
+func versionItemIDs(keys []string, formItems []FormItem) []string {
+	var answered []FormItem
+	for _, formItem := range formItems {
+		if hasAnswer(formItem) {
+			answered = append(answered, formItem)
+		}
+	}
+	same := len(answered) == len(keys)
+	for i := 0; same && i < len(keys); i++ {
+		same = answered[i].Label == keys[i]
+	}
+	if !same {
+		answered = make([]FormItem, len(keys))
+		for i, key := range keys {
+			answered[i].Label = key
+		}
+		matchItemIDs(answered, formItems)
+	}
+	ids := make([]string, len(keys))
+	for i := range answered {
+		ids[i] = answered[i].ID
+	}
+	return ids
+}
+
+// addItemIDs is the data migration of 0004_item_ids, it gives the form
+// items of every revision and form an id, and the versions the ids of
+// their answers. An item keeps the id of the item in the revision before
+// with the same label. The rows are read before any are updated as
+// sqlite has one connection
+func addItemIDs(tx sqlTx) error {
+	type revision struct {
+		id, formID int
+		created    string
+		formItems  []FormItem
+	}
+	var revisions []revision
+	err := queryRows(tx, `SELECT id, formid, created, formitems FROM revisions ORDER BY formid, id`, func(row scanner) error {
+		var r revision
+		formItemsJSON := ""
+		if err := row.Scan(&r.id, &r.formID, (*timestamp)(&r.created), &formItemsJSON); err != nil {
+			return err
+		}
+		revisions = append(revisions, r)
+		return json.Unmarshal([]byte(formItemsJSON), &revisions[len(revisions)-1].formItems)
+	})
+	if err != nil {
+		return err
+	}
+	type form struct {
+		id        int
+		formItems []FormItem
+	}
+	var forms []form
+	err = queryRows(tx, `SELECT id, formitems FROM forms`, func(row scanner) error {
+		var f form
+		formItemsJSON := ""
+		if err := row.Scan(&f.id, &formItemsJSON); err != nil {
+			return err
+		}
+		forms = append(forms, f)
+		return json.Unmarshal([]byte(formItemsJSON), &forms[len(forms)-1].formItems)
+	})
+	if err != nil {
+		return err
+	}
+	type version struct {
+		formID  int
+		version string
+		keys    []string
+	}
+	var versions []version
+	err = queryRows(tx, `SELECT formid, version, formkeys FROM versions`, func(row scanner) error {
+		var v version
+		formKeysJSON := ""
+		if err := row.Scan(&v.formID, (*timestamp)(&v.version), &formKeysJSON); err != nil {
+			return err
+		}
+		versions = append(versions, v)
+		return json.Unmarshal([]byte(formKeysJSON), &versions[len(versions)-1].keys)
+	})
+	if err != nil {
+		return err
+	}
+
+	latest := map[int][]FormItem{} // the latest revision of each form
+	for _, r := range revisions {
+		matchItemIDs(r.formItems, latest[r.formID])
+		latest[r.formID] = r.formItems
+		b, err := json.Marshal(r.formItems)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`UPDATE revisions SET formitems=? WHERE id=?`, string(b), r.id); err != nil {
+			return err
+		}
+	}
+	current := map[int][]FormItem{}
+	for _, f := range forms {
+		matchItemIDs(f.formItems, latest[f.id])
+		current[f.id] = f.formItems
+		b, err := json.Marshal(f.formItems)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.Exec(`UPDATE forms SET formitems=? WHERE id=?`, string(b), f.id); err != nil {
+			return err
+		}
+	}
+	for _, v := range versions {
+		// the version of a response is the form's updated time
+		// which is the created time of its revision
+		formItems := current[v.formID]
+		for _, r := range revisions {
+			if r.formID == v.formID && r.created == v.version {
+				formItems = r.formItems
+			}
+		}
+		b, err := json.Marshal(versionItemIDs(v.keys, formItems))
+		if err != nil {
+			return err
+		}
+		q := `UPDATE versions SET itemids=? WHERE formid=? AND version=?`
+		if _, err = tx.Exec(q, string(b), v.formID, v.version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryRows runs the query and calls fn for each row
+func queryRows(tx sqlTx, q string, fn func(row scanner) error) error {
+	rows, err := tx.Query(q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err = fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
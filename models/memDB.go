@@ -0,0 +1,536 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memDB keeps the tables in memory, for tests and demo mode
+// it is lost when the server stops. The mutex makes it safe
+// for use by the concurrent handlers
+type memDB struct {
+	mu        sync.RWMutex
+	users     []User
+	forms     []memForm
+	revisions []memRevision
+	versions  []memVersion
+	responses []memResponse
+	lastID    map[string]int // auto increment ids per table
+}
+
+// form items are kept as json like the sql tables
+// so forms read back are the same as with the other drivers
+type memForm struct {
+	Form
+	formItemsJSON string
+}
+
+type memRevision struct {
+	Revision
+	userID        int
+	formItemsJSON string
+}
+
+type memVersion struct {
+	formID    int
+	version   string
+	title     string
+	formKeys  []string
+	formTypes []string
+	itemIDs   []string
+}
+
+type memResponse struct {
+	Response
+	formID         int
+	created        string
+	formValuesJSON string
+}
+
+func newMemDB() *memDB {
+	return &memDB{lastID: map[string]int{}}
+}
+
+func (db *memDB) nextID(table string) int {
+	db.lastID[table]++
+	return db.lastID[table]
+}
+
+func now() string {
+	return time.Now().Format(timeLayout)
+}
+
+func openMemory(dsn string) (*Store, error) {
+	db := newMemDB()
+	return &Store{
+		User:     memUserDB{db},
+		Form:     memFormDB{db},
+		Response: memResponseDB{db},
+	}, nil
+}
+
+// memUserDB is the in memory users table
+type memUserDB struct {
+	*memDB
+}
+
+// New creates a new user
+func (db memUserDB) New(username, pwhash string) (userid int, duplicate bool, err error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, u := range db.users {
+		if u.Name == username {
+			return 0, true, nil
+		}
+	}
+	u := User{ID: db.nextID("users"), Name: username, Pwhash: pwhash, Created: now()}
+	db.users = append(db.users, u)
+	return u.ID, false, nil
+}
+
+// Get a user id and pwhash
+func (db memUserDB) Get(username string) (userid int, pwhash string, notFound bool, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, u := range db.users {
+		if u.Name == username {
+			return u.ID, u.Pwhash, false, nil
+		}
+	}
+	return 0, "", true, nil
+}
+
+// memFormDB is the in memory forms table
+type memFormDB struct {
+	*memDB
+}
+
+// find the index of the form, -1 if not found
+// userid -1 finds any user's form
+func (db memFormDB) find(id, userid int) int {
+	for i, f := range db.forms {
+		if f.ID == id && (userid == -1 || f.UserID == userid) {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetAll forms belonging to the user
+func (db memFormDB) GetAll(userid int) (forms []Form, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, f := range db.forms {
+		if f.UserID == userid {
+			forms = append(forms, Form{ID: f.ID, Title: f.Title, Updated: f.Updated})
+		}
+	}
+	return forms, nil
+}
+
+// Get a form belonging to the user
+func (db memFormDB) Get(id, userid int) (title string, formItems []FormItem, found bool, err error) {
+	title, _, formItems, found, err = db.get(id, userid)
+	return
+}
+
+// Use gets any form in the table
+func (db memFormDB) Use(id int) (title, updated string, formItems []FormItem, found bool, err error) {
+	return db.get(id, -1)
+}
+
+func (db memFormDB) get(id, userid int) (title, updated string, formItems []FormItem, found bool, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	i := db.find(id, userid)
+	if i == -1 {
+		return
+	}
+	f := db.forms[i]
+	err = json.Unmarshal([]byte(f.formItemsJSON), &formItems)
+	return f.Title, f.Updated, formItems, true, err
+}
+
+// New creates a new form belonging to the user
+func (db memFormDB) New(userid int) (id int, err error) {
+	formItemsJSON, err := newFormItemsJSON()
+	if err != nil {
+		return 0, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	f := memForm{
+		Form:          Form{ID: db.nextID("forms"), Title: newFormTitle, Updated: now(), UserID: userid},
+		formItemsJSON: formItemsJSON,
+	}
+	db.forms = append(db.forms, f)
+	db.newRevision(f)
+	return f.ID, nil
+}
+
+// newRevision copies the form into revisions, the mutex must be locked
+func (db memFormDB) newRevision(f memForm) {
+	db.revisions = append(db.revisions, memRevision{
+		Revision:      Revision{ID: db.nextID("revisions"), FormID: f.ID, Title: f.Title, Created: f.Updated},
+		userID:        f.UserID,
+		formItemsJSON: f.formItemsJSON,
+	})
+}
+
+// Delete form belonging to the user, and its revisions and responses
+func (db memFormDB) Delete(id, userid int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	i := db.find(id, userid)
+	if i == -1 {
+		return nil
+	}
+	db.forms = append(db.forms[:i], db.forms[i+1:]...)
+
+	revisions := db.revisions[:0]
+	for _, r := range db.revisions {
+		if r.FormID != id {
+			revisions = append(revisions, r)
+		}
+	}
+	db.revisions = revisions
+	versions := db.versions[:0]
+	for _, v := range db.versions {
+		if v.formID != id {
+			versions = append(versions, v)
+		}
+	}
+	db.versions = versions
+	responses := db.responses[:0]
+	for _, r := range db.responses {
+		if r.formID != id {
+			responses = append(responses, r)
+		}
+	}
+	db.responses = responses
+	return nil
+}
+
+// Update form belonging to the user, each update is saved as a revision
+func (db memFormDB) Update(id, userid int, title string, formItems []FormItem) error {
+	b, err := json.Marshal(withItemIDs(formItems))
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	i := db.find(id, userid)
+	if i == -1 {
+		return nil
+	}
+	f := &db.forms[i]
+	// if no change to title and formItems do not update
+	if title == f.Title && string(b) == f.formItemsJSON {
+		return nil
+	}
+	f.Title, f.formItemsJSON, f.Updated = title, string(b), now()
+	db.newRevision(*f)
+	return nil
+}
+
+// Check if form belongs to user
+func (db memFormDB) Check(id, userid int) (bool, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.find(id, userid) != -1, nil
+}
+
+// Revisions of a form belonging to the user, newest first
+func (db memFormDB) Revisions(id, userid int) (revisions []Revision, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.find(id, userid) == -1 {
+		return nil, nil
+	}
+	for i := len(db.revisions) - 1; i >= 0; i-- {
+		if db.revisions[i].FormID != id {
+			continue
+		}
+		rev, err := db.revision(db.revisions[i])
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, nil
+}
+
+// Revision gets a revision (by rev id) of a form belonging to the user
+func (db memFormDB) Revision(id, userid, rev int) (revision Revision, found bool, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.find(id, userid) == -1 {
+		return Revision{}, false, nil
+	}
+	for _, r := range db.revisions {
+		if r.ID == rev && r.FormID == id {
+			revision, err = db.revision(r)
+			return revision, err == nil, err
+		}
+	}
+	return Revision{}, false, nil
+}
+
+// revision fills in the form items and author, the mutex must be locked
+func (db memFormDB) revision(r memRevision) (Revision, error) {
+	rev := r.Revision
+	for _, u := range db.users {
+		if u.ID == r.userID {
+			rev.Author = u.Name
+		}
+	}
+	err := json.Unmarshal([]byte(r.formItemsJSON), &rev.FormItems)
+	return rev, err
+}
+
+// memResponseDB is the in memory versions and responses tables
+type memResponseDB struct {
+	*memDB
+}
+
+// New inserts a form response into version and response table
+func (db memResponseDB) New(r PostResponse) error {
+	b, err := json.Marshal(r.FormValues)
+	if err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	found := false
+	for _, v := range db.versions {
+		if v.formID == r.FormID && v.version == r.Version {
+			found = true
+			break
+		}
+	}
+	if !found {
+		keys := append([]string(nil), r.FormKeys...)
+		types := append([]string(nil), r.FormTypes...)
+		ids := append([]string(nil), r.ItemIDs...)
+		db.versions = append(db.versions, memVersion{r.FormID, r.Version, r.Title, keys, types, ids})
+	}
+	db.responses = append(db.responses, memResponse{
+		Response:       Response{ID: db.nextID("responses"), Version: r.Version},
+		formID:         r.FormID,
+		created:        now(),
+		formValuesJSON: string(b),
+	})
+	return nil
+}
+
+// Get all past responses to the form (by id) ordered by version
+func (db memResponseDB) Get(id int) (versions []ResponseSet, err error) {
+	versions, _, err = db.Find(id, ResponseQuery{})
+	return versions, err
+}
+
+// Versions of the form (by id) ordered by version, without the responses
+func (db memResponseDB) Versions(id int) (versions []ResponseSet, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.versionSets(id), nil
+}
+
+// versionSets are the versions of the form, the mutex must be locked
+func (db memResponseDB) versionSets(id int) (versions []ResponseSet) {
+	for _, v := range db.versions {
+		if v.formID != id {
+			continue
+		}
+		header := append(append([]string(nil), v.formKeys...), "created")
+		types := append([]string(nil), v.formTypes...)
+		ids := append([]string(nil), v.itemIDs...)
+		versions = append(versions, ResponseSet{Title: v.title, Version: v.version, TableHeader: header, Types: types, ItemIDs: ids})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions
+}
+
+// Find the versions of the form (by id), or the version of the query, with
+// the page of their responses that match the query, and the number of
+// responses that match
+func (db memResponseDB) Find(id int, q ResponseQuery) (versions []ResponseSet, total int, err error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	versions = db.versionSets(id)
+	if q.Version != "" {
+		versions = VersionOf(versions, q.Version)
+	}
+	if len(versions) == 0 {
+		return nil, 0, nil
+	}
+	at := map[string]int{}
+	for i, v := range versions {
+		at[v.Version] = i
+	}
+	words := SearchWords(q.Search)
+	var found []Response
+	for _, r := range db.responses {
+		if _, ok := at[r.Version]; r.formID != id || !ok {
+			continue
+		}
+		var data []Answer
+		if err := json.Unmarshal([]byte(r.formValuesJSON), &data); err != nil {
+			return nil, 0, err
+		}
+		data = append(data, Answer{r.created})
+		if (q.Version == "" || matchFilters(data, q.Filters)) && matchSearch(data[:len(data)-1], words) {
+			found = append(found, Response{ID: r.ID, Version: r.Version, Data: data})
+		}
+	}
+
+	less := func(a, b Response) bool {
+		if a.Version != b.Version {
+			return a.Version < b.Version
+		}
+		return a.ID < b.ID
+	}
+	if v := versions[0]; q.Version != "" && q.Sort >= 1 && q.Sort <= len(v.TableHeader) {
+		c := q.Sort - 1
+		number := c < len(v.Types) && v.Types[c] == "number"
+		less = func(a, b Response) bool {
+			x, y := answerText(a.Data, c), answerText(b.Data, c)
+			if number {
+				fx, errx := strconv.ParseFloat(x, 64)
+				fy, erry := strconv.ParseFloat(y, 64)
+				switch {
+				case (errx == nil) != (erry == nil):
+					return errx != nil // answers that are not numbers sort first
+				case errx == nil && fx != fy:
+					return fx < fy
+				}
+			} else if x != y {
+				return x < y
+			}
+			return a.ID < b.ID
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if q.Desc {
+			return less(found[j], found[i])
+		}
+		return less(found[i], found[j])
+	})
+
+	total = len(found)
+	if q.Limit > 0 {
+		offset := min(max(q.Offset, 0), len(found))
+		found = found[offset:min(offset+q.Limit, len(found))]
+	}
+	for _, r := range found {
+		versions[at[r.Version]].TableData = append(versions[at[r.Version]].TableData, r)
+	}
+	return versions, total, nil
+}
+
+// Each calls fn with each response to the form (by id), or to the version
+// if it is not blank, in the order they were made. The responses are
+// found first so fn is called without the lock
+func (db memResponseDB) Each(id int, version string, fn func(Response) error) error {
+	versions, _, err := db.Find(id, ResponseQuery{Version: version})
+	if err != nil {
+		return err
+	}
+	for _, v := range versions {
+		for _, r := range v.TableData {
+			if err = fn(r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// answerText is the text of answer c like the sql of the stores, an
+// answer of more than one value is its json text, "" if there is no answer
+func answerText(data []Answer, c int) string {
+	if c >= len(data) || data[c] == nil {
+		return ""
+	}
+	if len(data[c]) == 1 {
+		return data[c][0]
+	}
+	b, _ := json.Marshal([]string(data[c]))
+	return string(b)
+}
+
+// matchFilters is if the answers (not created) contain the text of the
+// filter of their column, ignoring case
+func matchFilters(data []Answer, filters map[int]string) bool {
+	for c, text := range filters {
+		if c < 1 || c >= len(data) || text == "" {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(answerText(data, c-1)), strings.ToLower(text)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Delete the responses (by id) to the form (by id), and the versions left
+// without responses. Ids of other forms are ignored
+func (db memResponseDB) Delete(formID int, ids []int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	deleted := map[int]bool{}
+	for _, id := range ids {
+		deleted[id] = true
+	}
+	responses := db.responses[:0]
+	for _, r := range db.responses {
+		if r.formID != formID || !deleted[r.ID] {
+			responses = append(responses, r)
+		}
+	}
+	db.responses = responses
+	versions := db.versions[:0]
+	for _, v := range db.versions {
+		if v.formID != formID || db.hasResponses(v) {
+			versions = append(versions, v)
+		}
+	}
+	db.versions = versions
+	return nil
+}
+
+// hasResponses is if the version has responses, the mutex must be locked
+func (db memResponseDB) hasResponses(v memVersion) bool {
+	for _, r := range db.responses {
+		if r.formID == v.formID && r.Version == v.version {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteVersion deletes all the responses to a version of the form
+// and the version
+func (db memResponseDB) DeleteVersion(formID int, version string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	responses := db.responses[:0]
+	for _, r := range db.responses {
+		if r.formID != formID || r.Version != version {
+			responses = append(responses, r)
+		}
+	}
+	db.responses = responses
+	versions := db.versions[:0]
+	for _, v := range db.versions {
+		if v.formID != formID || v.version != version {
+			versions = append(versions, v)
+		}
+	}
+	db.versions = versions
+	return nil
+}
@@ -0,0 +1,103 @@
+package models
+
+// Merge puts the responses to all the versions of a form in one set
+// the columns of the versions are matched by form item id, or by label
+// for versions without ids. An answer is blank if its form item was not
+// in the version of the response. The columns are in the order of the
+// latest version then the columns only in older versions, headed by the
+// latest label. The version and created columns are at the end
+func Merge(versions []ResponseSet) ResponseSet {
+	m := NewMerger(versions)
+	merged := m.Set
+	for _, set := range versions {
+		for _, r := range set.TableData {
+			merged.TableData = append(merged.TableData, m.row(set.Version, r))
+		}
+	}
+	return merged
+}
+
+// Merger puts the responses to the versions of a form in the columns of
+// their merged set a response at a time, e.g. as they are read from the
+// store. Set is the merged set without its responses
+type Merger struct {
+	Set ResponseSet
+	at  map[string][]int // the merged column of each column by version
+}
+
+// NewMerger matches the columns of the versions like Merge
+func NewMerger(versions []ResponseSet) Merger {
+	if len(versions) == 0 {
+		return Merger{}
+	}
+	type column struct {
+		id, label, inputType string
+	}
+	var columns []column
+	at := make(map[string][]int, len(versions))
+	for v := len(versions) - 1; v >= 0; v-- {
+		set := versions[v]
+		keys := set.TableHeader[:len(set.TableHeader)-1] // not created
+		at[set.Version] = make([]int, len(keys))
+		used := map[int]bool{} // a column is matched once per version
+		for i, key := range keys {
+			id, inputType := "", ""
+			if len(set.ItemIDs) == len(keys) {
+				id = set.ItemIDs[i]
+			}
+			if i < len(set.Types) {
+				inputType = set.Types[i]
+			}
+			c := -1
+			for j, col := range columns {
+				if !used[j] && (id != "" && col.id == id || id == "" && col.label == key) {
+					c = j
+					break
+				}
+			}
+			switch {
+			case c == -1:
+				columns = append(columns, column{id, key, inputType})
+				c = len(columns) - 1
+			case columns[c].inputType != inputType:
+				// files are only linked if the item was always a file
+				columns[c].inputType = ""
+			}
+			used[c] = true
+			at[set.Version][i] = c
+		}
+	}
+
+	latest := versions[len(versions)-1]
+	merged := ResponseSet{Title: latest.Title}
+	for _, col := range columns {
+		merged.TableHeader = append(merged.TableHeader, col.label)
+		merged.Types = append(merged.Types, col.inputType)
+		merged.ItemIDs = append(merged.ItemIDs, col.id)
+	}
+	merged.TableHeader = append(merged.TableHeader, "version", "created")
+	return Merger{merged, at}
+}
+
+// Row is the response in the columns of the merged set, the answers of a
+// version that was not merged are left out
+func (m Merger) Row(r Response) Response {
+	return m.row(r.Version, r)
+}
+
+// row is the response to the version in the columns of the merged set
+func (m Merger) row(version string, r Response) Response {
+	columns := max(len(m.Set.TableHeader)-2, 0) // not version and created
+	data := make([]Answer, columns, columns+2)
+	for i, c := range m.at[version] {
+		if i < len(r.Data)-1 {
+			data[c] = r.Data[i]
+		}
+	}
+	var created Answer
+	if len(r.Data) > 0 {
+		created = r.Data[len(r.Data)-1]
+	}
+	data = append(data, Answer{version}, created)
+	return Response{ID: r.ID, Version: r.Version, Data: data}
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrations/<dialect>/NNNN_name.sql are applied in order of NNNN
+// the schema version is the NNNN of the last one applied
+// and is recorded in the schema_migrations table
+//
+//go:embed migrations
+var migrations embed.FS
+
+// dataMigrations change the data in ways sql cannot e.g. the json in
+// formitems, each is run after the sql of the migration of its version
+var dataMigrations = map[int]func(tx sqlTx) error{
+	4: addItemIDs,
+	5: addSearchText,
+}
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations reads the migrations of a dialect ordered by version
+func loadMigrations(dialectName string) ([]migration, error) {
+	dir := path.Join("migrations", dialectName)
+	entries, err := migrations.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ms []migration
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		i := strings.Index(name, "_")
+		if i == -1 {
+			return nil, fmt.Errorf("migration %s: name is not NNNN_name.sql", name)
+		}
+		version, err := strconv.Atoi(name[:i])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %v", name, err)
+		}
+		b, err := migrations.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, migration{version, name, string(b)})
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].version < ms[j].version })
+	for i := 1; i < len(ms); i++ {
+		if ms[i].version == ms[i-1].version {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", ms[i-1].name, ms[i].name)
+		}
+	}
+	return ms, nil
+}
+
+// statements splits a migration into its statements, which end with ; at
+// the end of a line. Not all drivers can Exec many statements at once.
+// A trigger body from a line ending in BEGIN to END; is kept as one statement
+func statements(sql string) []string {
+	var stmts []string
+	var stmt strings.Builder
+	inBody := false
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if stmt.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+		stmt.WriteString(line + "\n")
+		upper := strings.ToUpper(trimmed)
+		if strings.HasSuffix(upper, "BEGIN") {
+			inBody = true
+		}
+		if inBody && upper != "END;" {
+			continue
+		}
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(stmt.String()))
+			stmt.Reset()
+			inBody = false
+		}
+	}
+	if s := strings.TrimSpace(stmt.String()); s != "" {
+		stmts = append(stmts, s)
+	}
+	return stmts
+}
+
+// migrate applies the migrations newer than the schema version
+// each migration and its schema_migrations row are done in a transaction
+// (mysql commits CREATE/ALTER TABLE statements on its own)
+func (db sqlDB) migrate() (version int, err error) {
+	q := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER NOT NULL PRIMARY KEY,
+		applied TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	if _, err = db.Exec(q); err != nil {
+		return 0, err
+	}
+	q = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+	if err = db.QueryRow(q).Scan(&version); err != nil {
+		return 0, err
+	}
+
+	ms, err := loadMigrations(db.name)
+	if err != nil {
+		return version, err
+	}
+	for _, m := range ms {
+		if m.version <= version {
+			continue
+		}
+		if err = db.apply(m); err != nil {
+			return version, fmt.Errorf("migration %s: %v", m.name, err)
+		}
+		version = m.version
+	}
+	return version, nil
+}
+
+func (db sqlDB) apply(m migration) error {
+	return db.inTx(func(tx sqlTx) error {
+		for _, stmt := range statements(m.sql) {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		if data, ok := dataMigrations[m.version]; ok {
+			if err := data(tx); err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, m.version)
+		return err
+	})
+}
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS `forms` (
+	`id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	`title` char(50) NOT NULL,
+	`formitems` text NOT NULL,
+	`updated` datetime NOT NULL,
+	`userid` int NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS `users` (
+	`id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	`name` char(8) NOT NULL UNIQUE,
+	`pwhash` char(60) NOT NULL,
+	`created` datetime NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS `versions` (
+	`formid` int NOT NULL,
+	`version` datetime NOT NULL,
+	`title` char(50) NOT NULL,
+	`formkeys` text NOT NULL,
+	PRIMARY KEY (`formid`,`version`)
+);
+
+CREATE TABLE IF NOT EXISTS `responses` (
+	`id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	`formvalues` text NOT NULL,
+	`created` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	`formid` int NOT NULL,
+	`version` datetime NOT NULL
+);
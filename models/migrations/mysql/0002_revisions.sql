@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS `revisions` (
+	`id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
+	`formid` int NOT NULL,
+	`title` char(50) NOT NULL,
+	`formitems` text NOT NULL,
+	`userid` int NOT NULL,
+	`created` datetime NOT NULL,
+	KEY `revisions_formid` (`formid`)
+);
+
+-- the forms as they are now are their first revisions
+INSERT INTO `revisions` (`formid`, `title`, `formitems`, `userid`, `created`)
+SELECT `id`, `title`, `formitems`, `userid`, `updated` FROM `forms`;
@@ -0,0 +1,3 @@
+-- the form item ids of the answers of a version, in the order of formkeys
+-- the ids of the existing form items and versions are added by addItemIDs
+ALTER TABLE `versions` ADD COLUMN `itemids` text;
@@ -0,0 +1,5 @@
+-- the text of the answers of a response, for the full-text search
+-- the text of the existing responses is added by addSearchText
+ALTER TABLE `responses` ADD COLUMN `searchtext` text;
+
+ALTER TABLE `responses` ADD FULLTEXT INDEX `responses_search` (`searchtext`);
@@ -0,0 +1,31 @@
+-- timestamp(0) keeps datetimes to the second, same as mysql datetime
+CREATE TABLE IF NOT EXISTS forms (
+	id SERIAL PRIMARY KEY,
+	title VARCHAR(50) NOT NULL,
+	formitems TEXT NOT NULL,
+	updated TIMESTAMP(0) NOT NULL,
+	userid INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR(8) NOT NULL UNIQUE,
+	pwhash CHAR(60) NOT NULL,
+	created TIMESTAMP(0) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS versions (
+	formid INTEGER NOT NULL,
+	version TIMESTAMP(0) NOT NULL,
+	title VARCHAR(50) NOT NULL,
+	formkeys TEXT NOT NULL,
+	PRIMARY KEY (formid, version)
+);
+
+CREATE TABLE IF NOT EXISTS responses (
+	id SERIAL PRIMARY KEY,
+	formvalues TEXT NOT NULL,
+	created TIMESTAMP(0) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	formid INTEGER NOT NULL,
+	version TIMESTAMP(0) NOT NULL
+);
@@ -0,0 +1,3 @@
+-- the form item types of a version, to know which answers are uploaded files
+-- versions saved before this are NULL
+ALTER TABLE versions ADD COLUMN formtypes TEXT;
@@ -0,0 +1,6 @@
+-- the text of the answers of a response, for the full-text search
+-- the text of the existing responses is added by addSearchText
+ALTER TABLE responses ADD COLUMN searchtext TEXT;
+
+-- the search must use the same expression to use the index
+CREATE INDEX IF NOT EXISTS responses_search ON responses USING GIN (to_tsvector('simple', COALESCE(searchtext, '')));
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS forms (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	title TEXT NOT NULL,
+	formitems TEXT NOT NULL,
+	updated DATETIME NOT NULL,
+	userid INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	pwhash TEXT NOT NULL,
+	created DATETIME NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS versions (
+	formid INTEGER NOT NULL,
+	version DATETIME NOT NULL,
+	title TEXT NOT NULL,
+	formkeys TEXT NOT NULL,
+	PRIMARY KEY (formid, version)
+);
+
+CREATE TABLE IF NOT EXISTS responses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	formvalues TEXT NOT NULL,
+	created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	formid INTEGER NOT NULL,
+	version DATETIME NOT NULL
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS revisions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	formid INTEGER NOT NULL,
+	title TEXT NOT NULL,
+	formitems TEXT NOT NULL,
+	userid INTEGER NOT NULL,
+	created DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS revisions_formid ON revisions (formid);
+
+-- the forms as they are now are their first revisions
+INSERT INTO revisions (formid, title, formitems, userid, created)
+SELECT id, title, formitems, userid, updated FROM forms;
@@ -0,0 +1,21 @@
+-- the text of the answers of a response, for the full-text search
+-- the text of the existing responses is added by addSearchText
+ALTER TABLE responses ADD COLUMN searchtext TEXT;
+
+-- an fts5 index of the searchtext of responses, kept by the triggers
+-- the existing responses are indexed without text, then updated
+CREATE VIRTUAL TABLE IF NOT EXISTS responses_search USING fts5(searchtext, content='responses', content_rowid='id');
+INSERT INTO responses_search (responses_search) VALUES ('rebuild');
+
+CREATE TRIGGER IF NOT EXISTS responses_search_insert AFTER INSERT ON responses BEGIN
+	INSERT INTO responses_search (rowid, searchtext) VALUES (new.id, new.searchtext);
+END;
+
+CREATE TRIGGER IF NOT EXISTS responses_search_delete AFTER DELETE ON responses BEGIN
+	INSERT INTO responses_search (responses_search, rowid, searchtext) VALUES ('delete', old.id, old.searchtext);
+END;
+
+CREATE TRIGGER IF NOT EXISTS responses_search_update AFTER UPDATE OF searchtext ON responses BEGIN
+	INSERT INTO responses_search (responses_search, rowid, searchtext) VALUES ('delete', old.id, old.searchtext);
+	INSERT INTO responses_search (rowid, searchtext) VALUES (new.id, new.searchtext);
+END;
@@ -11,9 +11,49 @@ type Form struct {
 
 // FormItem is a HTML input type item e.g. <input type='textbox'>
 type FormItem struct {
-	Label   string
-	Type    string
-	Options []string
+	ID          string // stays the same when the item is edited or moved
+	Label       string
+	Type        string
+	Options     []string
+	Rules       Rules
+	Show        *Condition `json:",omitempty"` // nil is always shown
+	Help        string     `json:",omitempty"` // shown under the item
+	Placeholder string     `json:",omitempty"`
+	Default     string     `json:",omitempty"` // checkboxes: options, comma separated
+	Key         string     `json:",omitempty"` // url query parameter that prefills the answer
+	Prefill     string     `json:",omitempty"` // "" can be changed, readonly or hidden
+}
+
+// Condition is when a form item is shown, if the answer to an earlier
+// form item (by index) is Value, or is not Value. A hidden item's
+// answer is not saved
+type Condition struct {
+	Item  int
+	Not   bool `json:",omitempty"`
+	Value string
+}
+
+// Rules are the checks on the answer to a form item
+// the zero value of each rule is no check
+type Rules struct {
+	Required bool     `json:",omitempty"`
+	MinLen   int      `json:",omitempty"`
+	MaxLen   int      `json:",omitempty"`
+	Pattern  string   `json:",omitempty"` // regexp the whole answer must match
+	Min      *float64 `json:",omitempty"` // the answer must be a number
+	Max      *float64 `json:",omitempty"` // if Min or Max is set
+	MaxKB    int      `json:",omitempty"` // the size of an uploaded file
+	Accept   string   `json:",omitempty"` // file types e.g. image/*,.pdf
+}
+
+// Revision is a saved edit of a form
+type Revision struct {
+	ID        int
+	FormID    int
+	Title     string
+	FormItems []FormItem
+	Author    string // user name of who saved it
+	Created   string
 }
 
 // User data
@@ -31,14 +71,16 @@ type PostResponse struct {
 	Version    string
 	Title      string
 	FormKeys   []string
-	FormValues []string
+	FormTypes  []string
+	ItemIDs    []string // the id of the form item of each answer
+	FormValues []Answer
 }
 
 // Response is the user submission data for that version of the form
 type Response struct {
 	ID      int
 	Version string
-	Data    []string
+	Data    []Answer
 }
 
 // ResponseSet is all the user responses to a version of the form
@@ -46,5 +88,43 @@ type ResponseSet struct {
 	Title       string
 	Version     string
 	TableHeader []string
+	Types       []string // the form item type of each column, if known
+	ItemIDs     []string // the form item id of each column
 	TableData   []Response
 }
+
+// ResponseQuery picks the responses of a page of a response table
+// the columns are numbered from 1 like the url of the page
+type ResponseQuery struct {
+	// Version is the version of the responses, blank for all versions
+	Version string
+	// Sort is the column of the version to sort by, the last column is
+	// created. 0 (and any column without a Version) sorts by created
+	Sort int
+	Desc bool
+	// Filters are the text the answers contain (ignoring case) by column
+	// only the answers of a Version can be filtered, not created
+	Filters map[int]string
+	// Search is the words the answers of the responses have, in any
+	// version, a word of the answers can start with a word searched for
+	Search string
+	// Offset and Limit are the page of the responses, Limit 0 is all
+	// and an Offset below 0 is 0
+	Offset, Limit int
+}
+
+// VersionOf is the versions with only the version, none if not found
+func VersionOf(versions []ResponseSet, version string) []ResponseSet {
+	for i, v := range versions {
+		if v.Version == version {
+			return versions[i : i+1]
+		}
+	}
+	return nil
+}
+
+// IsFile is if column i is of uploaded files
+// responses saved before the types were kept have no files
+func (s ResponseSet) IsFile(i int) bool {
+	return i < len(s.Types) && s.Types[i] == "file"
+}
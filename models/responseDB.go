@@ -3,78 +3,73 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
-
-	"github.com/go-sql-driver/mysql"
+	"fmt"
+	"strings"
 )
 
-// mysql statement to create the tables:
-//
-// CREATE TABLE `versions` (
-// 	`formid` int NOT NULL,
-// 	`version` datetime NOT NULL,
-// 	`title` char(50) NOT NULL,
-// 	`formkeys` text NOT NULL,
-// 	PRIMARY KEY (`formid`,`version`)
-// );
-//
-// CREATE TABLE `responses` (
-//	`id` int NOT NULL AUTO_INCREMENT,
-// 	`formvalues` text NOT NULL,
-// 	`created` datetime NOT NULL DEFAULT CURRENT_TIMESTAMP
-//  `formid` int NOT NULL,
-//  `version` datetime NOT NULL,
-//  PRIMARY KEY (`id`)
-// );
+// likeEscaper escapes the wildcards of LIKE ... ESCAPE '!', the escape
+// character is not \ as mysql strings use \ to escape
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
 
-// ResponseDB is the database handle with functions to access users table
+// ResponseDB is the database handle with functions to access versions and responses tables
 type ResponseDB struct {
-	*sql.DB
+	sqlDB
 }
 
 // New inserts a form response into version and response table
 // form title and keys are the same for a version of the form
-// and can have many responses per version
+// and can have many responses per version. Both inserts are in a
+// transaction so there is no version without a response or vice versa
 func (db ResponseDB) New(r PostResponse) error {
-	// insert into versions table if first response to this formversion
-	b, err := json.Marshal(r.FormKeys)
+	formKeysJSON, err := json.Marshal(r.FormKeys)
 	if err != nil {
 		return err
 	}
-	q := `INSERT INTO versions (formid, version, title, formkeys) VALUES (?, ?, ?, ?)`
-	_, err = db.Exec(q, r.FormID, r.Version, r.Title, string(b))
+	formTypesJSON, err := json.Marshal(r.FormTypes)
 	if err != nil {
-		// Error 1062: Duplicate entry 'xyz' for key 'versions.PRIMARY'
-		if err.(*mysql.MySQLError).Number != 1062 {
-			return err
-		}
+		return err
 	}
-	// insert into responses table - **consider how to do as transaction
-	b, err = json.Marshal(r.FormValues)
+	itemIDsJSON, err := json.Marshal(r.ItemIDs)
 	if err != nil {
 		return err
 	}
-	q = `INSERT INTO responses (formvalues, formid, version) VALUES (?, ?, ?)`
-	_, err = db.Exec(q, string(b), r.FormID, r.Version)
+	formValuesJSON, err := json.Marshal(r.FormValues)
 	if err != nil {
 		return err
 	}
-	return nil
+	return db.inTx(func(tx sqlTx) error {
+		// insert into versions table if first response to this formversion
+		q := `INSERT INTO versions (formid, version, title, formkeys, formtypes, itemids) VALUES (?, ?, ?, ?, ?, ?) ` + db.ignoreDuplicate
+		_, err := tx.Exec(q, r.FormID, r.Version, r.Title, string(formKeysJSON), string(formTypesJSON), string(itemIDsJSON))
+		if err != nil {
+			return err
+		}
+		q = `INSERT INTO responses (formvalues, searchtext, formid, version) VALUES (?, ?, ?, ?)`
+		_, err = tx.Exec(q, string(formValuesJSON), searchText(r.FormValues), r.FormID, r.Version)
+		return err
+	})
 }
 
 // Get all past responses to the form (by id)
-// it is assumed that query results are ordered by time
+// versions and responses are both ordered by version (time)
 func (db ResponseDB) Get(id int) (versions []ResponseSet, err error) {
-	// get versions
-	q := `SELECT version, title, formkeys FROM versions WHERE formid=?`
+	versions, _, err = db.Find(id, ResponseQuery{})
+	return versions, err
+}
+
+// Versions of the form (by id) ordered by version (time), without the
+// responses
+func (db ResponseDB) Versions(id int) (versions []ResponseSet, err error) {
+	q := `SELECT version, title, formkeys, COALESCE(formtypes, ''), COALESCE(itemids, '') FROM versions WHERE formid=? ORDER BY version`
 	rows, err := db.Query(q, id)
-	defer rows.Close()
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var v ResponseSet
-		formKeysJSON := ""
-		err = rows.Scan(&v.Version, &v.Title, &formKeysJSON)
+		formKeysJSON, formTypesJSON, itemIDsJSON := "", "", ""
+		err = rows.Scan((*timestamp)(&v.Version), &v.Title, &formKeysJSON, &formTypesJSON, &itemIDsJSON)
 		if err != nil {
 			return nil, err
 		}
@@ -82,43 +77,192 @@ func (db ResponseDB) Get(id int) (versions []ResponseSet, err error) {
 		if err != nil {
 			return
 		}
+		// NULL for versions saved before the types were kept
+		if formTypesJSON != "" {
+			if err = json.Unmarshal([]byte(formTypesJSON), &v.Types); err != nil {
+				return
+			}
+		}
+		// NULL if the item ids are not known
+		if itemIDsJSON != "" {
+			if err = json.Unmarshal([]byte(itemIDsJSON), &v.ItemIDs); err != nil {
+				return
+			}
+		}
 		v.TableHeader = append(v.TableHeader, "created")
 		versions = append(versions, v)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+	return versions, rows.Err()
+}
+
+// Find the versions of the form (by id), or the version of the query, with
+// the page of their responses that match the query, and the number of
+// responses that match. The search, sorting, filtering and paging are in
+// the sql
+func (db ResponseDB) Find(id int, q ResponseQuery) (versions []ResponseSet, total int, err error) {
+	versions, err = db.Versions(id)
+	if err != nil {
+		return nil, 0, err
+	}
+	// the version then id is the order the responses were made (created)
+	dir := ""
+	if q.Desc {
+		dir = " DESC"
+	}
+	where := `formid=?`
+	args := []interface{}{id}
+	order := `version` + dir + `, id` + dir
+	if q.Version != "" {
+		versions = VersionOf(versions, q.Version)
+		if len(versions) == 0 {
+			return nil, 0, nil
+		}
+		where += ` AND version=?`
+		args = append(args, q.Version)
+		v := versions[0]
+		columns := len(v.TableHeader) - 1 // not created
+		for c, text := range q.Filters {
+			if c < 1 || c > columns || text == "" {
+				continue
+			}
+			where += fmt.Sprintf(` AND LOWER(%s) LIKE ? ESCAPE '!'`, db.answer(c-1))
+			args = append(args, "%"+likeEscaper.Replace(strings.ToLower(text))+"%")
+		}
+		switch {
+		case q.Sort >= 1 && q.Sort <= columns:
+			expr := db.answer(q.Sort - 1)
+			if q.Sort-1 < len(v.Types) && v.Types[q.Sort-1] == "number" {
+				expr = db.number(expr)
+			}
+			order = expr + dir + `, id` + dir
+		case q.Sort == columns+1:
+			order = `created` + dir + `, id` + dir
+		}
 	}
 	if len(versions) == 0 {
-		return nil, nil
+		return nil, 0, nil
 	}
-	// get responses
-	indexer := 0
-	q = `SELECT id, formvalues, created, version FROM responses WHERE formid=?`
-	rows, err = db.Query(q, id)
+	if words := SearchWords(q.Search); len(words) != 0 {
+		cond, searchArgs := db.search(words)
+		where += ` AND ` + cond
+		args = append(args, searchArgs...)
+	}
+	if q.Limit > 0 {
+		err = db.QueryRow(`SELECT COUNT(*) FROM responses WHERE `+where, args...).Scan(&total)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	query := `SELECT id, formvalues, created, version FROM responses WHERE ` + where + ` ORDER BY ` + order
+	if q.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d OFFSET %d`, q.Limit, max(q.Offset, 0))
+	}
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	defer rows.Close()
+	at := map[string]int{} // the index of each version
+	for i, v := range versions {
+		at[v.Version] = i
 	}
+	n := 0
 	for rows.Next() {
-		var r Response
-		formValuesJSON := ""
-		created := ""
-		err = rows.Scan(&r.ID, &formValuesJSON, &created, &r.Version)
+		r, err := scanResponse(rows)
 		if err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		err = json.Unmarshal([]byte(formValuesJSON), &r.Data)
+		i, ok := at[r.Version]
+		if !ok {
+			continue // a response saved between the two queries
+		}
+		versions[i].TableData = append(versions[i].TableData, r)
+		n++
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if q.Limit <= 0 {
+		total = n
+	}
+	return versions, total, nil
+}
+
+// Each calls fn with each response to the form (by id), or to the version
+// if it is not blank, in the order they were made. The responses are read
+// a row at a time so they are not all kept in memory, it stops at the
+// first error of fn
+func (db ResponseDB) Each(id int, version string, fn func(Response) error) error {
+	where := `formid=?`
+	args := []interface{}{id}
+	if version != "" {
+		where += ` AND version=?`
+		args = append(args, version)
+	}
+	rows, err := db.Query(`SELECT id, formvalues, created, version FROM responses WHERE `+where+` ORDER BY version, id`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		r, err := scanResponse(rows)
 		if err != nil {
-			return
+			return err
 		}
-		r.Data = append(r.Data, created)
-		// the assumption here is that results are ordered by time
-		if r.Version != versions[indexer].Version {
-			indexer++
+		if err = fn(r); err != nil {
+			return err
 		}
-		versions[indexer].TableData = append(versions[indexer].TableData, r)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+	return rows.Err()
+}
+
+// scanResponse is the response of the row of id, formvalues, created and
+// version, created is its last answer
+func scanResponse(rows *sql.Rows) (r Response, err error) {
+	formValuesJSON := ""
+	created := ""
+	err = rows.Scan(&r.ID, &formValuesJSON, (*timestamp)(&created), (*timestamp)(&r.Version))
+	if err != nil {
+		return r, err
+	}
+	if err = json.Unmarshal([]byte(formValuesJSON), &r.Data); err != nil {
+		return r, err
 	}
-	return versions, nil
+	r.Data = append(r.Data, Answer{created})
+	return r, nil
+}
+
+// Delete the responses (by id) to the form (by id), and the versions left
+// without responses, in a transaction. Ids of other forms are ignored
+func (db ResponseDB) Delete(formID int, ids []int) error {
+	return db.inTx(func(tx sqlTx) error {
+		q := `DELETE FROM responses WHERE id=? AND formid=?`
+		for _, id := range ids {
+			if _, err := tx.Exec(q, id, formID); err != nil {
+				return err
+			}
+		}
+		q = `DELETE FROM versions WHERE formid=? AND NOT EXISTS
+			(SELECT 1 FROM responses r WHERE r.formid=versions.formid AND r.version=versions.version)`
+		_, err := tx.Exec(q, formID)
+		return err
+	})
+}
+
+// DeleteVersion deletes all the responses to a version of the form
+// and the version
+func (db ResponseDB) DeleteVersion(formID int, version string) error {
+	return db.inTx(func(tx sqlTx) error {
+		qq := []string{
+			`DELETE FROM responses WHERE formid=? AND version=?`,
+			`DELETE FROM versions WHERE formid=? AND version=?`,
+		}
+		for _, q := range qq {
+			if _, err := tx.Exec(q, formID, version); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// the revisions table keeps every saved edit of a form
+// FormDB.New and FormDB.Update add a revision
+
+// newRevision copies the form as it is now into revisions
+// the revision created time is the form's updated time
+func newRevision(tx sqlTx, id int) error {
+	q := `INSERT INTO revisions (formid, title, formitems, userid, created)
+		SELECT id, title, formitems, userid, updated FROM forms WHERE id=?`
+	_, err := tx.Exec(q, id)
+	return err
+}
+
+const revisionsQuery = `SELECT r.id, r.formid, r.title, r.formitems, COALESCE(u.name, ''), r.created
+	FROM revisions r JOIN forms f ON f.id=r.formid LEFT JOIN users u ON u.id=r.userid
+	WHERE r.formid=? AND f.userid=?`
+
+// Revisions of a form belonging to the user, newest first
+func (db FormDB) Revisions(id, userid int) (revisions []Revision, err error) {
+	rows, err := db.Query(revisionsQuery+` ORDER BY r.id DESC`, id, userid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// Revision gets a revision (by rev id) of a form belonging to the user
+func (db FormDB) Revision(id, userid, rev int) (revision Revision, found bool, err error) {
+	row := db.QueryRow(revisionsQuery+` AND r.id=?`, id, userid, rev)
+	revision, err = scanRevision(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Revision{}, false, nil
+		}
+		return Revision{}, false, err
+	}
+	return revision, true, nil
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRevision(row scanner) (rev Revision, err error) {
+	formItemsJSON := ""
+	err = row.Scan(&rev.ID, &rev.FormID, &rev.Title, &formItemsJSON, &rev.Author, (*timestamp)(&rev.Created))
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal([]byte(formItemsJSON), &rev.FormItems)
+	return
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+)
+
+// String describes the rules e.g. required, max length 8
+func (r Rules) String() string {
+	var rules []string
+	if r.Required {
+		rules = append(rules, "required")
+	}
+	if r.MinLen != 0 {
+		rules = append(rules, "min length "+strconv.Itoa(r.MinLen))
+	}
+	if r.MaxLen != 0 {
+		rules = append(rules, "max length "+strconv.Itoa(r.MaxLen))
+	}
+	if r.Pattern != "" {
+		rules = append(rules, "pattern "+r.Pattern)
+	}
+	if r.Min != nil {
+		rules = append(rules, "min "+FormatNumber(*r.Min))
+	}
+	if r.Max != nil {
+		rules = append(rules, "max "+FormatNumber(*r.Max))
+	}
+	if r.MaxKB != 0 {
+		rules = append(rules, "max size "+strconv.Itoa(r.MaxKB)+" KB")
+	}
+	if r.Accept != "" {
+		rules = append(rules, "accept "+r.Accept)
+	}
+	return strings.Join(rules, ", ")
+}
+
+// String describes the condition e.g. item 2 is No
+func (c *Condition) String() string {
+	if c == nil {
+		return ""
+	}
+	is := " is "
+	if c.Not {
+		is = " is not "
+	}
+	return "item " + strconv.Itoa(c.Item+1) + is + c.Value
+}
+
+// FormatNumber without exponent or trailing zeros e.g. 1.5, 1000000
+func FormatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+)
+
+// the search of the responses finds the responses with words that start
+// with each of the words searched for, in any answer. The searchtext of a
+// response is the words of its answers, it has a full-text index for each
+// driver: fts5 (sqlite), FULLTEXT (mysql) and GIN (postgres). The words
+// are split by SearchWords not by each driver, e.g. postgres keeps
+// lam@bbq.com and 1.5 as one word
+
+// SearchWords are the words of the text in lower case, the letters and
+// digits between the spaces and punctuation
+func SearchWords(text string) []string {
+	var words []string
+	seen := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), notWordRune) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// searchText is the words of the answers that are searched, split by
+// spaces so every driver finds the same words
+func searchText(values []Answer) string {
+	var lines []string
+	for _, answer := range values {
+		lines = append(lines, answer...)
+	}
+	return strings.Join(SearchWords(strings.Join(lines, "\n")), " ")
+}
+
+// matchSearch is if the answers have a word starting with each of the
+// words, like the sql of the search
+func matchSearch(data []Answer, words []string) bool {
+	have := SearchWords(searchText(data))
+	for _, word := range words {
+		found := false
+		for _, h := range have {
+			found = found || strings.HasPrefix(h, word)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// addSearchText is the data migration of 0005_search, it adds the text of
+// the answers of the existing responses. The rows are read before any are
+// updated as sqlite has one connection
+func addSearchText(tx sqlTx) error {
+	texts := map[int]string{}
+	err := queryRows(tx, `SELECT id, formvalues FROM responses`, func(row scanner) error {
+		id, formValuesJSON := 0, ""
+		if err := row.Scan(&id, &formValuesJSON); err != nil {
+			return err
+		}
+		var values []Answer
+		if err := json.Unmarshal([]byte(formValuesJSON), &values); err != nil {
+			return err
+		}
+		texts[id] = searchText(values)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for id, text := range texts {
+		if _, err = tx.Exec(`UPDATE responses SET searchtext=? WHERE id=?`, text, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// topValues is the number of the most common answers in a summary of the
+// answers to an item that are not choices e.g. text
+const topValues = 5
+
+// Summary is the statistics of the responses of a response set, of a
+// version or all the versions merged
+type Summary struct {
+	Title     string
+	Version   string // blank for all the versions merged
+	Responses int
+	PerDay    []Count // the responses made each day (by created)
+	Columns   []ColumnSummary
+}
+
+// ColumnSummary is the statistics of the answers to a form item
+type ColumnSummary struct {
+	Label string
+	// Type is the form item type, blank if not known or it changed
+	// between the versions merged
+	Type string
+	// Asked is the responses to the versions with the item, Answered
+	// is the answers of them that are not blank
+	Asked, Answered int
+	// Counts are the answers with each option (select, radio and
+	// checkboxes) with the options of the form not picked, ticked or not
+	// (checkbox) or the most common answers (the other types except
+	// number and file)
+	Counts []Count
+	// Min, Max and Mean are of the answers that are finite numbers
+	// (number) nil if there are none
+	Min, Max, Mean *float64
+}
+
+// Count is the number of answers (or responses) with the value
+type Count struct {
+	Value   string
+	N       int
+	Percent int // of the answers (or responses) counted
+}
+
+// Summarize is the summary of the responses of the set, a version
+// or all the versions merged (see Merge). The options of the form items
+// (by id) are counted if they are not picked
+func Summarize(set ResponseSet, formItems []FormItem) Summary {
+	s := Summary{Title: set.Title, Version: set.Version, Responses: len(set.TableData)}
+	columns := len(set.TableHeader) - 1 // not created
+	if set.Version == "" {
+		columns-- // and version
+	}
+	days := map[string]int{}
+	for _, r := range set.TableData {
+		if created := r.Data[len(r.Data)-1].String(); len(created) >= len("2006-01-02") {
+			days[created[:len("2006-01-02")]]++
+		}
+	}
+	s.PerDay = counts(days, s.Responses)
+	sort.Slice(s.PerDay, func(i, j int) bool { return s.PerDay[i].Value < s.PerDay[j].Value })
+	items := map[string]FormItem{}
+	for _, item := range formItems {
+		items[item.ID] = item
+	}
+
+	for c := 0; c < columns; c++ {
+		col := ColumnSummary{Label: set.TableHeader[c]}
+		if c < len(set.Types) {
+			col.Type = set.Types[c]
+		}
+		var answers []Answer
+		for _, r := range set.TableData {
+			// nil if the item was not in the version of the response
+			if c < len(r.Data)-1 && r.Data[c] != nil {
+				answers = append(answers, r.Data[c])
+			}
+		}
+		col.Asked = len(answers)
+		for _, answer := range answers {
+			if answer.String() != "" {
+				col.Answered++
+			}
+		}
+		var options []string
+		if c < len(set.ItemIDs) && set.ItemIDs[c] != "" && items[set.ItemIDs[c]].Type == col.Type {
+			options = items[set.ItemIDs[c]].Options
+		}
+		summarizeAnswers(&col, answers, options)
+		s.Columns = append(s.Columns, col)
+	}
+	return s
+}
+
+// Summaries are the summaries of each version, after the summary of all
+// the versions merged if there is more than one
+func Summaries(versions []ResponseSet, formItems []FormItem) []Summary {
+	var summaries []Summary
+	if len(versions) > 1 {
+		summaries = append(summaries, Summarize(Merge(versions), formItems))
+	}
+	for _, v := range versions {
+		summaries = append(summaries, Summarize(v, formItems))
+	}
+	return summaries
+}
+
+// summarizeAnswers adds the statistics of the answers for the column type
+// the options are of the form item of a choice, to count those not picked
+func summarizeAnswers(col *ColumnSummary, answers []Answer, options []string) {
+	values := map[string]int{}
+	switch col.Type {
+	case "file":
+		// only the uploads are counted, as Answered
+	case "checkbox":
+		ticked := 0
+		for _, answer := range answers {
+			if answer.String() != "" {
+				ticked++
+			}
+		}
+		col.Counts = []Count{
+			{"ticked", ticked, percent(ticked, col.Asked)},
+			{"not ticked", col.Asked - ticked, percent(col.Asked-ticked, col.Asked)},
+		}
+	case "number":
+		n, sum := 0, 0.0
+		for _, answer := range answers {
+			// one NaN or Inf would be the min, max and mean
+			f, err := strconv.ParseFloat(strings.TrimSpace(answer.String()), 64)
+			if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+				continue
+			}
+			if n == 0 || f < *col.Min {
+				col.Min = &f
+			}
+			if n == 0 || f > *col.Max {
+				col.Max = &f
+			}
+			n++
+			sum += f
+		}
+		if n != 0 {
+			mean := math.Round(sum/float64(n)*100) / 100
+			col.Mean = &mean
+		}
+	case "select", "radio", "checkboxes":
+		// each of the options ticked is counted, the options of the form
+		// that are not are 0
+		for _, option := range options {
+			values[option] = 0
+		}
+		for _, answer := range answers {
+			for _, value := range answer {
+				if value != "" {
+					values[value]++
+				}
+			}
+		}
+		col.Counts = counts(values, col.Answered)
+	default:
+		for _, answer := range answers {
+			if value := strings.TrimSpace(answer.String()); value != "" {
+				values[value]++
+			}
+		}
+		col.Counts = counts(values, col.Answered)
+		if len(col.Counts) > topValues {
+			col.Counts = col.Counts[:topValues]
+		}
+	}
+}
+
+// counts are the counts of the values, the most common first
+func counts(values map[string]int, total int) []Count {
+	var cs []Count
+	for value, n := range values {
+		cs = append(cs, Count{value, n, percent(n, total)})
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].N != cs[j].N {
+			return cs[i].N > cs[j].N
+		}
+		return cs[i].Value < cs[j].Value
+	})
+	return cs
+}
+
+// percent is n of total as a whole percentage
+func percent(n, total int) int {
+	if total == 0 {
+		return 0
+	}
+	return int(math.Round(float64(n) * 100 / float64(total)))
+}
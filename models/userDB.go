@@ -3,40 +3,24 @@ package models
 import (
 	"database/sql"
 	"errors"
-
-	"github.com/go-sql-driver/mysql"
 )
 
-// mysql statement to create the table:
-//
-// CREATE TABLE `users` (
-// 	`id` int NOT NULL PRIMARY KEY AUTO_INCREMENT,
-// 	`name` char(8) NOT NULL UNIQUE,
-// 	`pwhash` char(60) NOT NULL,
-// 	`created` datetime NOT NULL
-// );
-
 // UserDB is the database handle with functions to access users table
 type UserDB struct {
-	*sql.DB
+	sqlDB
 }
 
 // New creates a new user
 func (db UserDB) New(username, pwhash string) (userid int, duplicate bool, err error) {
-	q := `INSERT INTO users (name, pwhash, created) VALUES (?, ?, NOW())`
-	r, err := db.Exec(q, username, pwhash)
+	q := `INSERT INTO users (name, pwhash, created) VALUES (?, ?, CURRENT_TIMESTAMP)`
+	userid, err = db.insert(q, username, pwhash)
 	if err != nil {
-		// Error 1062: Duplicate entry 'xyz' for key 'users.name'
-		if err.(*mysql.MySQLError).Number == 1062 {
+		if db.duplicate(err) {
 			return 0, true, nil
 		}
-		return
-	}
-	id, err := r.LastInsertId()
-	if err != nil {
-		return
+		return 0, false, err
 	}
-	return int(id), false, nil
+	return userid, false, nil
 }
 
 // Get a user id and pwhash
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"forms/models"
+)
+
+// the charts are svg made from the summaries of the responses, inline in
+// the summary page and downloaded as files. They are drawn in a fixed
+// width and scaled to the largest count
+
+const (
+	chartWidth  = 480
+	chartLabel  = 160 // the width of the labels of the bars
+	chartBarRow = 24  // the height of a bar and the space after it
+	chartColour = "#4a7bd0"
+)
+
+// chartResp downloads a chart of the summary of the responses to a version
+// (or all the versions merged if there is no version) as an svg file, the
+// bar chart of the answers to a column e.g. /resp/4/chart?column=2 or the
+// responses per day without a column
+func (app *application) chartResp(w http.ResponseWriter, r *http.Request) {
+	id, title, formItems, ok := app.ownForm(w, r)
+	if !ok {
+		return
+	}
+	versions, err := app.response.Get(id)
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "500 Internal Server Error", 500)
+		return
+	}
+	query := r.URL.Query()
+	set := models.Merge(versions)
+	if version := query.Get("version"); version != "" {
+		found := false
+		for _, v := range versions {
+			if v.Version == version {
+				set, found = v, true
+			}
+		}
+		if !found {
+			http.Error(w, "404 Version not found", 404)
+			return
+		}
+		title += " " + version
+	}
+	s := models.Summarize(set, formItems)
+
+	chart := timelineChart(s.PerDay)
+	name := title + " per day"
+	if value := query.Get("column"); value != "" {
+		c, err := strconv.Atoi(value)
+		if err != nil || c < 1 || c > len(s.Columns) || !hasChart(s.Columns[c-1]) {
+			http.Error(w, "404 Chart not found", 404)
+			return
+		}
+		chart = barChart(s.Columns[c-1])
+		name = title + " " + s.Columns[c-1].Label
+	}
+	if chart == "" {
+		http.Error(w, "404 Chart not found", 404) // no responses
+		return
+	}
+	setDownload(w, "image/svg+xml", name+".svg")
+	if _, err = io.WriteString(w, string(chart)); err != nil {
+		app.errorLog.Print(err)
+	}
+}
+
+// for template.FuncMap, if the answers to the column are charted, the
+// choices and checkboxes
+func hasChart(col models.ColumnSummary) bool {
+	return stringIs(col.Type, "select", "radio", "checkboxes", "checkbox") && len(col.Counts) != 0
+}
+
+// for template.FuncMap, the bar chart of the counts of the answers to the
+// column, a bar for each value
+func barChart(col models.ColumnSummary) template.HTML {
+	most := 1
+	for _, c := range col.Counts {
+		most = max(most, c.N)
+	}
+	height := len(col.Counts)*chartBarRow + 8
+	barMax := chartWidth - chartLabel - 80 // room for the count after the bar
+	var b strings.Builder
+	svgStart(&b, height, col.Label)
+	for i, c := range col.Counts {
+		y := i*chartBarRow + 4
+		width := float64(barMax * c.N / most)
+		fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%s</text>`, chartLabel-6, y+15, xmlEscape(chartText(c.Value, 24)))
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%s" height="18" fill="%s"><title>%s</title></rect>`,
+			chartLabel, y+2, svgNumber(width), chartColour, xmlEscape(c.Value))
+		fmt.Fprintf(&b, `<text x="%s" y="%d">%d (%d%%)</text>`, svgNumber(float64(chartLabel)+width+4), y+15, c.N, c.Percent)
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// for template.FuncMap, the chart of the responses made each day, from
+// the first to the last day, with the days without responses
+func timelineChart(perDay []models.Count) template.HTML {
+	if len(perDay) == 0 {
+		return ""
+	}
+	counts := map[string]int{}
+	for _, c := range perDay {
+		counts[c.Value] = c.N
+	}
+	var days []string
+	first, err1 := time.Parse("2006-01-02", perDay[0].Value)
+	last, err2 := time.Parse("2006-01-02", perDay[len(perDay)-1].Value)
+	if err1 != nil || err2 != nil {
+		for _, c := range perDay {
+			days = append(days, c.Value)
+		}
+	} else {
+		for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+			days = append(days, d.Format("2006-01-02"))
+		}
+	}
+	most := 1
+	for _, c := range perDay {
+		most = max(most, c.N)
+	}
+
+	const left, top, plotHeight = 40, 10, 120
+	plotWidth := float64(chartWidth - left - 10)
+	barWidth := plotWidth / float64(len(days))
+	var b strings.Builder
+	svgStart(&b, top+plotHeight+24, "responses per day")
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">%d</text>`, left-6, top+10, most)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" text-anchor="end">0</text>`, left-6, top+plotHeight)
+	for i, day := range days {
+		height := float64(plotHeight * counts[day] / most)
+		fmt.Fprintf(&b, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"><title>%s: %d</title></rect>`,
+			svgNumber(left+float64(i)*barWidth), svgNumber(top+plotHeight-height), svgNumber(max(barWidth-1, 0.5)), svgNumber(height),
+			chartColour, xmlEscape(day), counts[day])
+	}
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%s" y2="%d" stroke="#888"/>`, left, top+plotHeight, svgNumber(left+plotWidth), top+plotHeight)
+	fmt.Fprintf(&b, `<text x="%d" y="%d">%s</text>`, left, top+plotHeight+18, xmlEscape(days[0]))
+	if len(days) > 1 {
+		fmt.Fprintf(&b, `<text x="%s" y="%d" text-anchor="end">%s</text>`, svgNumber(left+plotWidth), top+plotHeight+18, xmlEscape(days[len(days)-1]))
+	}
+	b.WriteString("</svg>")
+	return template.HTML(b.String())
+}
+
+// svgStart writes the start of an svg of the chart width, titled
+func svgStart(b *strings.Builder, height int, title string) {
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="12">`,
+		chartWidth, height, chartWidth, height)
+	fmt.Fprintf(b, `<title>%s</title>`, xmlEscape(title))
+}
+
+// svgNumber is a coordinate to one decimal place
+func svgNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', 1, 64)
+}
+
+// chartText is the text cut to n characters to fit a label
+func chartText(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:n-1]) + "…"
+}
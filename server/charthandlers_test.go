@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"forms/models"
+)
+
+// TestBarChart draws a bar for each value, the labels escaped and cut short
+func TestBarChart(t *testing.T) {
+	col := models.ColumnSummary{Label: "Dish <main>", Type: "radio", Counts: []models.Count{
+		{Value: "Fish & chips", N: 4, Percent: 67}, {Value: "Chicken", N: 2, Percent: 33}, {Value: "A very long option that does not fit", N: 0, Percent: 0},
+	}}
+	if !hasChart(col) {
+		t.Fatal("radio column not charted")
+	}
+	chart := string(barChart(col))
+	if err := xml.Unmarshal([]byte(chart), new(struct{})); err != nil {
+		t.Fatalf("not xml: %v\n%s", err, chart)
+	}
+	if n := strings.Count(chart, "<rect "); n != 3 {
+		t.Errorf("%d bars, want 3", n)
+	}
+	for _, want := range []string{"<title>Dish &lt;main&gt;</title>", "Fish &amp; chips", "4 (67%)", "A very long option that…", `width="240.0"`, `width="120.0"`} {
+		if !strings.Contains(chart, want) {
+			t.Errorf("chart missing %q:\n%s", want, chart)
+		}
+	}
+
+	for _, col := range []models.ColumnSummary{
+		{Type: "text", Counts: col.Counts}, {Type: "number"}, {Type: "select"},
+	} {
+		if hasChart(col) {
+			t.Errorf("%s column with %d counts charted", col.Type, len(col.Counts))
+		}
+	}
+}
+
+// TestTimelineChart draws a bar for each day from the first to the last,
+// with the days without responses
+func TestTimelineChart(t *testing.T) {
+	if chart := timelineChart(nil); chart != "" {
+		t.Errorf("chart without responses: %s", chart)
+	}
+	chart := string(timelineChart([]models.Count{{Value: "2020-12-30", N: 2, Percent: 40}, {Value: "2021-01-02", N: 3, Percent: 60}}))
+	if err := xml.Unmarshal([]byte(chart), new(struct{})); err != nil {
+		t.Fatalf("not xml: %v\n%s", err, chart)
+	}
+	if n := strings.Count(chart, "<rect "); n != 4 {
+		t.Errorf("%d bars, want 4:\n%s", n, chart)
+	}
+	for _, want := range []string{"<title>2020-12-31: 0</title>", "<title>2021-01-02: 3</title>", ">2020-12-30</text>", ">2021-01-02</text>"} {
+		if !strings.Contains(chart, want) {
+			t.Errorf("chart missing %q:\n%s", want, chart)
+		}
+	}
+}
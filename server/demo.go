@@ -0,0 +1,50 @@
+package main
+
+import "forms/models"
+
+// demoUser is the user id of the demo (not logged in) user
+const demoUser = 0
+
+type demoForm struct {
+	title     string
+	formItems []models.FormItem
+}
+
+// the sample forms shown in demo mode
+var demoForms = []demoForm{
+	{"Lam's BBQ Order", []models.FormItem{
+		{Label: "Qty", Type: "select", Options: []string{"1", "2", "3"}},
+		{Label: "Order", Type: "select", Options: []string{"Chicken", "Fish", "Pork", "Beef"}},
+		{Label: "Chilli packs", Type: "checkbox"},
+		{Label: "Disposable cutlery", Type: "checkbox"},
+		{Label: "Comments", Type: "text"},
+		{Label: "Name", Type: "text"},
+		{Label: "Contact", Type: "text"},
+		{Label: "Delivery address (if any)", Type: "text"},
+		{Label: "Self collection", Type: "checkbox"},
+	}},
+	{"Team Lunch", []models.FormItem{
+		{Label: "Name", Type: "text"},
+		{Label: "Attending", Type: "checkbox"},
+		{Label: "Diet", Type: "select", Options: []string{"No restrictions", "Vegetarian", "Halal"}},
+	}},
+	{"Feedback", []models.FormItem{
+		{Label: "Rating", Type: "select", Options: []string{"Good", "Okay", "Bad"}},
+		{Label: "Comments", Type: "text"},
+	}},
+}
+
+// addDemoForms puts the sample forms into a new (empty) store
+// these are the demo forms with ids 1/2/3
+func addDemoForms(forms models.FormStore) error {
+	for _, f := range demoForms {
+		id, err := forms.New(demoUser)
+		if err != nil {
+			return err
+		}
+		if err = forms.Update(id, demoUser, f.title, f.formItems); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"forms/models"
+)
+
+// exportResp downloads the responses to a form, all the versions in one
+// table like the merged view, or one version (?version=2020-12-01 10:00:00)
+// e.g. /resp/4/export?format=csv&bom=1, the formats are csv, json (an array
+// of records), ndjson (a record per line) and xlsx (a worksheet per version)
+// The responses are written as they are read from the store, except xlsx
+// as the widths of its columns are before its rows
+func (app *application) exportResp(w http.ResponseWriter, r *http.Request) {
+	id, title, _, ok := app.ownForm(w, r)
+	if !ok {
+		return
+	}
+	versions, err := app.response.Versions(id)
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "500 Internal Server Error", 500)
+		return
+	}
+
+	query := r.URL.Query()
+	merger := models.NewMerger(versions)
+	set := merger.Set
+	name := title
+	answers := len(set.TableHeader) - 2 // not version and created
+	version := query.Get("version")
+	if version != "" {
+		versions = models.VersionOf(versions, version)
+		if len(versions) == 0 {
+			http.Error(w, "404 Version not found", 404)
+			return
+		}
+		set = versions[0]
+		answers = len(set.TableHeader) - 1
+		name += " " + version
+	}
+	rows := func(fn func(models.Response) error) error {
+		return app.response.Each(id, version, func(r models.Response) error {
+			if version == "" {
+				r = merger.Row(r)
+			}
+			return fn(r)
+		})
+	}
+
+	switch query.Get("format") {
+	case "", "csv":
+		setDownload(w, "text/csv; charset=utf-8", name+".csv")
+		err = writeCSV(w, set, rows, query.Get("bom") != "")
+	case "json", "ndjson":
+		ndjson := query.Get("format") == "ndjson"
+		if ndjson {
+			setDownload(w, "application/x-ndjson; charset=utf-8", name+".ndjson")
+		} else {
+			setDownload(w, "application/json; charset=utf-8", name+".json")
+		}
+		err = writeJSON(w, id, set, answers, rows, ndjson)
+	case "xlsx":
+		setDownload(w, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", name+".xlsx")
+		var sheets []models.ResponseSet // a worksheet per version
+		if sheets, err = app.response.Get(id); err == nil {
+			if version != "" {
+				sheets = models.VersionOf(sheets, version)
+			}
+			err = writeXLSX(w, sheets)
+		}
+	default:
+		http.Error(w, "400 Invalid data", 400)
+		return
+	}
+	// the download has started, it can only be cut short
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+}
+
+// setDownload sets the headers of a file download named name
+// characters that cannot be in a file name are replaced by _
+func setDownload(w http.ResponseWriter, contentType, name string) {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+}
+
+// exportValue is an answer as text in a download, the values of a
+// checkboxes answer one per line and a file as the path of its link
+func exportValue(set models.ResponseSet, i int, answer models.Answer) string {
+	if set.IsFile(i) && answer.String() != "" {
+		return fileURLs(answer)
+	}
+	return answer.String()
+}
+
+// fileURLs are the download links of the files of an answer, one per line
+func fileURLs(answer models.Answer) string {
+	links := make([]string, len(answer))
+	for i, key := range answer {
+		links[i] = fileURL(key)
+	}
+	return strings.Join(links, "\n")
+}
+
+// exportRecord is a response in a json download, the answers are keyed by
+// the label of their form item, the answers to items that were not in the
+// version of the response are left out
+type exportRecord struct {
+	ID      int                      `json:"id"`
+	FormID  int                      `json:"form_id"`
+	Version string                   `json:"version"`
+	Created string                   `json:"created"`
+	Answers map[string]models.Answer `json:"answers"`
+}
+
+// flushRecords is how many records of a json download are written
+// between flushes, so a long download is sent as it is written
+const flushRecords = 100
+
+// exportKeys are the keys of the answers of the records of the set, the
+// first answers columns of the set are answers. A label used by more than
+// one column is numbered e.g. Name (2)
+func exportKeys(set models.ResponseSet, answers int) []string {
+	keys := make([]string, max(answers, 0)) // a set without versions has no header
+	seen := map[string]int{}
+	for i := range keys {
+		label := set.TableHeader[i]
+		seen[label]++
+		keys[i] = label
+		if seen[label] > 1 {
+			keys[i] = label + " (" + strconv.Itoa(seen[label]) + ")"
+		}
+	}
+	return keys
+}
+
+// newExportRecord is the response of the set as a record with the answers
+// by keys, the last answer of the response is created
+func newExportRecord(formID int, set models.ResponseSet, keys []string, r models.Response) exportRecord {
+	rec := exportRecord{ID: r.ID, FormID: formID, Version: r.Version, Answers: map[string]models.Answer{}}
+	if len(r.Data) > 0 {
+		rec.Created = r.Data[len(r.Data)-1].String()
+	}
+	for i, key := range keys {
+		if i >= len(r.Data) || r.Data[i] == nil {
+			continue
+		}
+		answer := r.Data[i]
+		if set.IsFile(i) {
+			answer = make(models.Answer, len(r.Data[i]))
+			for j, fileKey := range r.Data[i] {
+				if fileKey != "" {
+					answer[j] = fileURL(fileKey)
+				}
+			}
+		}
+		rec.Answers[key] = answer
+	}
+	return rec
+}
+
+// writeJSON writes the responses of rows as records of the set, a json
+// array or ndjson one record per line. Each record is written as it is
+// read, and flushed every flushRecords records if w can be flushed
+func writeJSON(w io.Writer, formID int, set models.ResponseSet, answers int, rows func(func(models.Response) error) error, ndjson bool) error {
+	keys := exportKeys(set, answers)
+	enc := json.NewEncoder(w)
+	sep, n := "[\n", 0
+	err := rows(func(r models.Response) error {
+		if !ndjson {
+			if _, err := io.WriteString(w, sep); err != nil {
+				return err
+			}
+			sep = ","
+		}
+		if err := enc.Encode(newExportRecord(formID, set, keys, r)); err != nil {
+			return err
+		}
+		if n++; n%flushRecords == 0 {
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+		}
+		return nil
+	})
+	switch {
+	case err != nil || ndjson:
+		return err
+	case n == 0:
+		_, err = io.WriteString(w, "[]\n")
+	default:
+		_, err = io.WriteString(w, "]\n")
+	}
+	return err
+}
+
+// writeCSV writes the header of the set then the responses of rows as csv
+// a row at a time as they are read so the download is not kept in memory.
+// The utf-8 byte order mark is for spreadsheet apps that need it to read
+// the csv as utf-8
+func writeCSV(w io.Writer, set models.ResponseSet, rows func(func(models.Response) error) error, bom bool) error {
+	if bom {
+		if _, err := w.Write([]byte("\ufeff")); err != nil {
+			return err
+		}
+	}
+	cw := csv.NewWriter(w)
+	row := make([]string, len(set.TableHeader))
+	for i, key := range set.TableHeader {
+		row[i] = csvCell(key)
+	}
+	if err := cw.Write(row); err != nil {
+		return err
+	}
+	err := rows(func(r models.Response) error {
+		for i := range row {
+			row[i] = ""
+			if i < len(r.Data) {
+				row[i] = csvCell(exportValue(set, i, r.Data[i]))
+			}
+		}
+		return cw.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell is the value with a ' in front if a spreadsheet app would run it
+// as a formula e.g. =HYPERLINK(...), negative numbers are left as they are
+func csvCell(value string) string {
+	if value == "" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return value
+	}
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	return "'" + value
+}
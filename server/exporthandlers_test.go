@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"forms/models"
+)
+
+func TestWriteCSV(t *testing.T) {
+	set := models.ResponseSet{
+		TableHeader: []string{"Name", "Sides", "CV", "=Total", "created"},
+		Types:       []string{"text", "checkboxes", "file", "number"},
+		TableData: []models.Response{
+			{Data: []models.Answer{{`Lam "BBQ", Tan`}, {"Rice", "Fries"}, {"4/u/cv #1.pdf"}, {"-2"}, {"2020-12-01 10:00:00"}}},
+			{Data: []models.Answer{{"=HYPERLINK(\"x\")"}, nil, {""}, {"+65 9123"}, {"2020-12-02 10:00:00"}}},
+		},
+	}
+	want := [][]string{
+		{"Name", "Sides", "CV", "'=Total", "created"},
+		{`Lam "BBQ", Tan`, "Rice\nFries", "/file/4/u/cv%20%231.pdf", "-2", "2020-12-01 10:00:00"},
+		{"'=HYPERLINK(\"x\")", "", "", "'+65 9123", "2020-12-02 10:00:00"},
+	}
+	for _, bom := range []bool{false, true} {
+		var b bytes.Buffer
+		if err := writeCSV(&b, set, tableRows(set), bom); err != nil {
+			t.Fatal(err)
+		}
+		if got := bytes.HasPrefix(b.Bytes(), []byte("\xef\xbb\xbf")); got != bom {
+			t.Errorf("bom %v: starts with a bom %v", bom, got)
+		}
+		got, err := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(b.Bytes(), []byte("\xef\xbb\xbf")))).ReadAll()
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("bom %v: got %q err %v, want %q", bom, got, err, want)
+		}
+	}
+}
+
+// tableRows reads the responses of the set like the rows of an export
+func tableRows(set models.ResponseSet) func(func(models.Response) error) error {
+	return func(fn func(models.Response) error) error {
+		for _, r := range set.TableData {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	set := models.ResponseSet{
+		TableHeader: []string{"Name", "Sides", "CV", "Name", "version", "created"},
+		Types:       []string{"text", "checkboxes", "file", "text"},
+		TableData: []models.Response{
+			{ID: 7, Version: "2020-12-01 10:00:00", Data: []models.Answer{{"Lam"}, {"Rice", "Fries"}, {"4/u/cv?.pdf"}, nil, {"2020-12-01 10:00:00"}, {"2020-12-01 11:00:00"}}},
+			{ID: 9, Version: "2020-12-02 10:00:00", Data: []models.Answer{{"Tan"}, {}, {""}, {"Tan Ah Kow"}, {"2020-12-02 10:00:00"}, {"2020-12-02 11:00:00"}}},
+		},
+	}
+	want := []exportRecord{
+		{7, 4, "2020-12-01 10:00:00", "2020-12-01 11:00:00", map[string]models.Answer{"Name": {"Lam"}, "Sides": {"Rice", "Fries"}, "CV": {"/file/4/u/cv%3F.pdf"}}},
+		{9, 4, "2020-12-02 10:00:00", "2020-12-02 11:00:00", map[string]models.Answer{"Name": {"Tan"}, "Sides": {}, "CV": {""}, "Name (2)": {"Tan Ah Kow"}}},
+	}
+	keys := exportKeys(set, 4)
+	for i, r := range set.TableData {
+		if rec := newExportRecord(4, set, keys, r); !reflect.DeepEqual(rec, want[i]) {
+			t.Fatalf("record %d: got %v, want %v", i, rec, want[i])
+		}
+	}
+	var b bytes.Buffer
+	if err := writeJSON(&b, 4, set, 4, tableRows(set), false); err != nil {
+		t.Fatal(err)
+	}
+	var got []map[string]any
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil || len(got) != 2 {
+		t.Fatalf("json: %v %s", err, b.Bytes())
+	}
+	if got[0]["form_id"] != 4.0 || got[1]["answers"].(map[string]any)["Name (2)"] != "Tan Ah Kow" {
+		t.Errorf("json: %s", b.Bytes())
+	}
+	b.Reset()
+	if err := writeJSON(&b, 4, set, 4, tableRows(set), true); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	for i, line := range lines {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(line), &rec); err != nil || rec["id"] != float64(want[i].ID) {
+			t.Errorf("ndjson line %d: %v %s", i, err, line)
+		}
+	}
+	if len(lines) != 2 {
+		t.Errorf("ndjson: got %d lines, want 2", len(lines))
+	}
+	b.Reset()
+	if err := writeJSON(&b, 4, models.Merge(nil), -2, tableRows(models.Merge(nil)), false); err != nil || b.String() != "[]\n" {
+		t.Errorf("no responses: %q %v", b.String(), err)
+	}
+
+	// a long download is flushed as it is written
+	for len(set.TableData) <= flushRecords {
+		set.TableData = append(set.TableData, set.TableData[0])
+	}
+	rec := httptest.NewRecorder()
+	if err := writeJSON(rec, 4, set, 4, tableRows(set), true); err != nil || !rec.Flushed {
+		t.Errorf("%d records flushed %v err %v", len(set.TableData), rec.Flushed, err)
+	}
+}
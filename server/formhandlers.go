@@ -14,6 +14,7 @@ const (
 	editMode
 	viewMode
 	respMode
+	histMode
 )
 
 type pageData struct {
@@ -21,6 +22,34 @@ type pageData struct {
 	models.User
 	Feedback string // change to Errs []string to use multi errs
 	PageMode int
+	Answers  []answer // the use page's answers to each form item
+	Page     int      // the use page's page of the form
+	PageOf   []int    // the page of each form item
+	LastPage int
+	Upload   string // the use page's token of the files uploaded (see uploads)
+}
+
+// answer is what a respondent entered for a form item
+// kept to show again with what is wrong with it
+type answer struct {
+	Value   string
+	Values  []string // the options ticked in a checkboxes form item
+	Err     string
+	Prefill string // readonly or hidden if prefilled from the url
+}
+
+// Ticked is if the option is one of the answer's Values
+func (a answer) Ticked(option string) bool {
+	return stringIs(option, a.Values...)
+}
+
+// matches is if the answer is value, or for checkboxes one of the
+// options ticked is value, or none are ticked and value is blank
+func (a answer) matches(value string) bool {
+	if a.Values == nil {
+		return a.Value == value
+	}
+	return a.Ticked(value)
 }
 
 func (app *application) chooseForm(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +89,7 @@ func (app *application) addRemForm(w http.ResponseWriter, r *http.Request) {
 	}
 
 	u := r.Context().Value(contextKey("user")).(models.User)
-	if action != "res" && u.ID == 0 {
+	if !stringIs(action, "res", "his") && u.ID == 0 {
 		http.Redirect(w, r, "/login", 303)
 		return
 	}
@@ -80,12 +109,19 @@ func (app *application) addRemForm(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "500 Internal Server Error", 500)
 			return
 		}
+		// the form is gone, files left behind are only logged
+		if err = app.files.Delete(strconv.Itoa(id)); err != nil {
+			app.errorLog.Print(err)
+		}
 	case "auth":
 		http.Redirect(w, r, "/logout", 303)
 		return
 	case "res":
 		http.Redirect(w, r, "/resp/"+strconv.Itoa(id), 303)
 		return
+	case "his":
+		http.Redirect(w, r, "/hist/"+strconv.Itoa(id), 303)
+		return
 	}
 
 	http.Redirect(w, r, "/edit", http.StatusSeeOther)
@@ -130,25 +166,45 @@ func (app *application) editForm(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "400 Invalid data", 400)
 			return
 		}
+		if feedback == "" {
+			feedback = checkRules(formItems)
+		}
 	}
 
 	switch action {
 	case "add":
 		formItems = append(formItems[:index+1], formItems[index:]...)
-		formItems[index+1] = models.FormItem{Label: "", Type: "text", Options: nil}
+		formItems[index+1] = models.FormItem{ID: models.NewItemID(formItems), Label: "", Type: "text", Options: nil}
+		moveConditions(formItems, func(old int) int {
+			if old > index {
+				return old + 1
+			}
+			return old
+		})
 	case "del":
 		if len(formItems) == 1 {
-			formItems = []models.FormItem{{Label: "", Type: "text", Options: nil}}
+			formItems = []models.FormItem{{ID: models.NewItemID(nil), Label: "", Type: "text", Options: nil}}
 		} else {
 			formItems = append(formItems[:index], formItems[index+1:]...)
 		}
+		moveConditions(formItems, func(old int) int {
+			if old == index {
+				return -1
+			}
+			if old > index {
+				return old - 1
+			}
+			return old
+		})
 	case "upp":
 		if index != 0 {
 			formItems[index-1], formItems[index] = formItems[index], formItems[index-1]
+			moveConditions(formItems, swap(index-1, index))
 		}
 	case "dwn":
 		if index != len(formItems)-1 {
 			formItems[index], formItems[index+1] = formItems[index+1], formItems[index]
+			moveConditions(formItems, swap(index, index+1))
 		}
 	case "opt":
 		options := formItems[index].Options
@@ -172,15 +228,15 @@ func (app *application) editForm(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 		formItems[index].Options = options
-	case "txt":
-		formItems[index].Type = "text"
-		formItems[index].Options = nil
-	case "cxb":
-		formItems[index].Type = "checkbox"
+	case "txt", "cxb", "num", "eml", "dat", "tim", "url", "txa", "fil", "sec":
+		formItems[index].Type = inputTypes[action]
 		formItems[index].Options = nil
-	case "sel":
-		formItems[index].Type = "select"
-		formItems[index].Options = []string{""}
+	case "sel", "rad", "cbs":
+		// changing between select, radio and checkboxes keeps the options
+		if !hasOptions(formItems[index].Type) {
+			formItems[index].Options = []string{""}
+		}
+		formItems[index].Type = inputTypes[action]
 	case "edit":
 		pageMode = editMode // does nothing, editMode is the default, more readable than blank line
 	case "view":
@@ -220,3 +276,16 @@ func (app *application) editForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// swap is the newIndex for moveConditions when items i and j swap places
+func swap(i, j int) func(old int) int {
+	return func(old int) int {
+		switch old {
+		case i:
+			return j
+		case j:
+			return i
+		}
+		return old
+	}
+}
@@ -22,10 +22,10 @@ var app application
 // this is the stuff that main.go does before the handler can work
 func init() {
 	tmpl := template.Must(template.New("").
-		Funcs(template.FuncMap{"minus1": minus1}).
+		Funcs(templateFuncs).
 		ParseGlob("../ui/html/*.tmpl"))
 
-	re := regexp.MustCompile(`(^(add|del|upp|dwn|txt|cxb|sel)\d+$|^opt\d+ (add|del|upp|dwn)\d+$)`)
+	re := regexp.MustCompile(actionPattern)
 
 	app = application{
 		errorLog: log.New(ioutil.Discard, "", 0),
@@ -80,6 +80,26 @@ func TestViewFormLayout(t *testing.T) {
 				{Label: "Contact", Type: "text", Options: nil},
 			},
 		},
+		{
+			name:  "All input types",
+			title: "Lam's",
+			formItems: []models.FormItem{
+				{Label: "Name", Type: "text", Options: nil},
+				{Label: "Qty", Type: "number", Options: nil},
+				{Label: "Email", Type: "email", Options: nil},
+				{Label: "Date", Type: "date", Options: nil},
+				{Label: "Time", Type: "time", Options: nil},
+				{Label: "Website", Type: "url", Options: nil},
+				{Label: "Comments", Type: "textarea", Options: nil},
+				{Label: "Chilli", Type: "checkbox", Options: nil},
+				{Label: "Order", Type: "select", Options: []string{"Chicken", "Fish"}},
+				{Label: "Size", Type: "radio", Options: []string{"Small", "Large"}},
+				{Label: "Sides", Type: "checkboxes", Options: []string{"Rice", "Salad", ""}},
+				{Label: "", Type: "radio", Options: []string{"1", "2"}},
+				{Label: "Page 2", Type: "section", Options: nil},
+				{Label: "CV", Type: "file", Options: nil},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -118,6 +138,26 @@ func TestEditFormLayout(t *testing.T) {
 				{Label: "Contact", Type: "text", Options: nil},
 			},
 		},
+		{
+			name:  "All input types",
+			title: "Lam's",
+			formItems: []models.FormItem{
+				{Label: "Name", Type: "text", Options: nil},
+				{Label: "Qty", Type: "number", Options: nil},
+				{Label: "Email", Type: "email", Options: nil},
+				{Label: "Date", Type: "date", Options: nil},
+				{Label: "Time", Type: "time", Options: nil},
+				{Label: "Website", Type: "url", Options: nil},
+				{Label: "Comments", Type: "textarea", Options: nil},
+				{Label: "Chilli", Type: "checkbox", Options: nil},
+				{Label: "Order", Type: "select", Options: []string{"Chicken", "Fish"}},
+				{Label: "Size", Type: "radio", Options: []string{"Small", "Large"}},
+				{Label: "Sides", Type: "checkboxes", Options: []string{"Rice", "Salad", ""}},
+				{Label: "", Type: "radio", Options: []string{"1", "2"}},
+				{Label: "Page 2", Type: "section", Options: nil},
+				{Label: "CV", Type: "file", Options: nil},
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -203,6 +243,56 @@ func TestEditFormActions(t *testing.T) {
 				{Label: "1", Type: "checkbox", Options: nil},
 			},
 		},
+		{
+			name:   "Change form item type txt/num",
+			action: "num0",
+			formItems: []models.FormItem{
+				{Label: "1", Type: "text", Options: nil},
+			},
+			expected: []models.FormItem{
+				{Label: "1", Type: "number", Options: nil},
+			},
+		},
+		{
+			name:   "Change form item type text/radio",
+			action: "rad0",
+			formItems: []models.FormItem{
+				{Label: "1", Type: "text", Options: nil},
+			},
+			expected: []models.FormItem{
+				{Label: "1", Type: "radio", Options: []string{""}},
+			},
+		},
+		{
+			name:   "Change form item type select/checkboxes keeps options",
+			action: "cbs0",
+			formItems: []models.FormItem{
+				{Label: "1", Type: "select", Options: []string{"a", "b"}},
+			},
+			expected: []models.FormItem{
+				{Label: "1", Type: "checkboxes", Options: []string{"a", "b"}},
+			},
+		},
+		{
+			name:   "Add checkboxes option item",
+			action: "opt0 add1",
+			formItems: []models.FormItem{
+				{Label: "1", Type: "checkboxes", Options: []string{"a", "b"}},
+			},
+			expected: []models.FormItem{
+				{Label: "1", Type: "checkboxes", Options: []string{"a", "b", ""}},
+			},
+		},
+		{
+			name:   "Change form item type select/textarea",
+			action: "txa0",
+			formItems: []models.FormItem{
+				{Label: "1", Type: "select", Options: []string{""}},
+			},
+			expected: []models.FormItem{
+				{Label: "1", Type: "textarea", Options: nil},
+			},
+		},
 		{
 			name:   "Add select option item",
 			action: "opt0 add0",
@@ -3,10 +3,19 @@ package main
 import (
 	"encoding/base64"
 	"fmt"
+	"html/template"
+	"math"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/mail"
+	"net/url"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"forms/models"
@@ -15,19 +24,73 @@ import (
 const maxUsernameLen = 8
 const maxFormTitleLen = 50
 
+// maxUploadSize is the most a response with its files can be
+const maxUploadSize = 10 << 20
+
+// actionPattern matches the form editor actions e.g. add3, opt2 del1
+const actionPattern = `(^(add|del|upp|dwn|txt|cxb|sel|num|eml|dat|tim|url|txa|rad|cbs|fil|sec)\d+$|^opt\d+ (add|del|upp|dwn)\d+$)`
+
+// inputTypes are the form item types, by their editor action
+var inputTypes = map[string]string{
+	"txt": "text",
+	"cxb": "checkbox",
+	"sel": "select",
+	"num": "number",
+	"eml": "email",
+	"dat": "date",
+	"tim": "time",
+	"url": "url",
+	"txa": "textarea",
+	"rad": "radio",
+	"cbs": "checkboxes",
+	"fil": "file",
+	"sec": "section",
+}
+
+// hasOptions is if the input type is a choice of its options
+func hasOptions(inputType string) bool {
+	return stringIs(inputType, "select", "radio", "checkboxes")
+}
+
+// getAction splits an action e.g. del12 into del and the index 12
 func getAction(action string) (string, int, error) {
+	if len(action) < 3 {
+		return "", 0, fmt.Errorf("invalid action: [%s]", action)
+	}
 	index, err := strconv.Atoi(action[3:])
 	if err != nil {
 		return "", 0, err
 	}
+	if index < 0 {
+		return "", 0, fmt.Errorf("invalid action: [%s]", action)
+	}
 	return action[:3], index, nil
 }
 
+// templateFuncs are the funcs used in the templates
+var templateFuncs = template.FuncMap{
+	"minus1": minus1, "plus1": plus1, "number": number, "hasOptions": hasOptions, "fileName": fileName, "fileURL": fileURL,
+	"highlight": highlight, "hasChart": hasChart, "barChart": barChart, "timelineChart": timelineChart,
+}
+
 //for template.FuncMap
 func minus1(x int) int {
 	return x - 1
 }
 
+// for template.FuncMap, e.g. form item numbers from 1
+func plus1(x int) int {
+	return x + 1
+}
+
+// for template.FuncMap, the number or "" if not set
+func number(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return models.FormatNumber(*f)
+}
+
 func validateUsername(username string) (err string) {
 	if username == "" {
 		return "user name cannot be blank"
@@ -56,21 +119,70 @@ func validateForm(r *http.Request, re *regexp.Regexp) (formItems []models.FormIt
 		err = fmt.Errorf("number of labels, types not equal")
 		return
 	}
+	ids := r.Form["id"] // none or blank are new form items
+	if ids != nil && len(ids) != len(labels) {
+		err = fmt.Errorf("number of labels, ids not equal")
+		return
+	}
+	seen := map[string]bool{}
 	for i, label := range labels { // range []string(nil) is ok doesnt panic
 		var options []string
-		if !stringIs(inputType[i], "text", "checkbox", "select") {
+		if !isInputType(inputType[i]) {
 			err = fmt.Errorf("[%s] invalid input type: [%s]", label, inputType[i])
 			return
 		}
 
-		if inputType[i] == "select" {
+		if hasOptions(inputType[i]) {
 			opts := r.Form["options"+strconv.Itoa(i)]
 			for _, option := range opts {
 				options = append(options, strings.TrimSpace(option))
 			}
 		}
-		label = strings.TrimSpace(label)
-		formItems = append(formItems, models.FormItem{Label: label, Type: inputType[i], Options: options})
+		var rules models.Rules
+		rules, err = validateRules(r, i)
+		if err != nil {
+			err = fmt.Errorf("[%s] %v", label, err)
+			return
+		}
+		var show *models.Condition
+		show, err = validateCondition(r, i, len(labels))
+		if err != nil {
+			err = fmt.Errorf("[%s] %v", label, err)
+			return
+		}
+		id := ""
+		if ids != nil {
+			id = ids[i]
+		}
+		if id != "" && (!models.ValidItemID(id) || seen[id]) {
+			err = fmt.Errorf("[%s] invalid or duplicate id: [%s]", label, id)
+			return
+		}
+		seen[id] = true
+		n := strconv.Itoa(i)
+		prefill := r.FormValue("prefill" + n)
+		if !stringIs(prefill, "", "readonly", "hidden") {
+			err = fmt.Errorf("[%s] invalid prefill: [%s]", label, prefill)
+			return
+		}
+		formItems = append(formItems, models.FormItem{
+			ID:          id,
+			Label:       strings.TrimSpace(label),
+			Type:        inputType[i],
+			Options:     options,
+			Rules:       rules,
+			Show:        show,
+			Help:        strings.TrimSpace(r.FormValue("help" + n)),
+			Placeholder: strings.TrimSpace(r.FormValue("placeholder" + n)),
+			Default:     strings.TrimSpace(r.FormValue("default" + n)),
+			Key:         strings.TrimSpace(r.FormValue("key" + n)),
+			Prefill:     prefill,
+		})
+	}
+	for i := range formItems {
+		if formItems[i].ID == "" {
+			formItems[i].ID = models.NewItemID(formItems)
+		}
 	}
 
 	action = r.FormValue("action")
@@ -96,6 +208,539 @@ func validateForm(r *http.Request, re *regexp.Regexp) (formItems []models.FormIt
 	return
 }
 
+// validateRules gets the rules of form item i
+// e.g. required0=on&minlen0=1&maxlen0=8&pattern0=[a-z]*&min0=&max0=
+func validateRules(r *http.Request, i int) (rules models.Rules, err error) {
+	n := strconv.Itoa(i)
+	rules.Required = r.FormValue("required"+n) == "on"
+	rules.Pattern = strings.TrimSpace(r.FormValue("pattern" + n))
+	if rules.MinLen, err = formInt(r, "minlen"+n); err != nil {
+		return
+	}
+	if rules.MaxLen, err = formInt(r, "maxlen"+n); err != nil {
+		return
+	}
+	if rules.Min, err = formNumber(r, "min"+n); err != nil {
+		return
+	}
+	if rules.Max, err = formNumber(r, "max"+n); err != nil {
+		return
+	}
+	rules.Accept = strings.TrimSpace(r.FormValue("accept" + n))
+	rules.MaxKB, err = formInt(r, "maxkb"+n)
+	return
+}
+
+// validateCondition gets when form item i is shown, nil if always
+// e.g. show2=0&shownot2=on&showvalue2=No is shown if item 0 is not No
+func validateCondition(r *http.Request, i, numItems int) (*models.Condition, error) {
+	n := strconv.Itoa(i)
+	show := r.FormValue("show" + n)
+	if show == "" {
+		return nil, nil
+	}
+	item, err := strconv.Atoi(show)
+	if err != nil || item < 0 || item >= numItems {
+		return nil, fmt.Errorf("invalid show%s: [%s]", n, show)
+	}
+	return &models.Condition{
+		Item:  item,
+		Not:   r.FormValue("shownot"+n) == "on",
+		Value: strings.TrimSpace(r.FormValue("showvalue" + n)),
+	}, nil
+}
+
+// moveConditions updates the items the conditions refer to after the
+// form items are moved, newIndex is where the item at old is now
+// or -1 if it was deleted, which deletes the conditions on it
+func moveConditions(formItems []models.FormItem, newIndex func(old int) int) {
+	for i, formItem := range formItems {
+		if formItem.Show == nil {
+			continue
+		}
+		show := *formItem.Show
+		show.Item = newIndex(show.Item)
+		formItems[i].Show = &show
+		if show.Item == -1 {
+			formItems[i].Show = nil
+		}
+	}
+}
+
+// formInt is the form value as a whole number >= 0, 0 if blank
+func formInt(r *http.Request, key string) (int, error) {
+	value := strings.TrimSpace(r.FormValue(key))
+	if value == "" {
+		return 0, nil
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid %s: [%s]", key, value)
+	}
+	return i, nil
+}
+
+// formInts are the form values (e.g. of checkboxes) as whole numbers
+func formInts(r *http.Request, key string) ([]int, error) {
+	var ints []int
+	for _, value := range r.Form[key] {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: [%s]", key, value)
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
+
+// filterPattern is the name of the filter of a response table column
+var filterPattern = regexp.MustCompile(`^f([1-9][0-9]*)$`)
+
+// responseQuery is the query of a response table in the url
+// e.g. ?version=2020-12-01+10:00:00&sort=2&desc=1&page=3&f1=lam&q=fish
+// the columns are from 1, the filters are f and their column, q is the
+// search of all the answers
+func responseQuery(query url.Values) (q models.ResponseQuery, page int, err error) {
+	q.Version = query.Get("version")
+	q.Desc = query.Get("desc") == "1"
+	q.Search = strings.TrimSpace(query.Get("q"))
+	if value := query.Get("sort"); value != "" {
+		if q.Sort, err = strconv.Atoi(value); err != nil || q.Sort < 1 {
+			return q, 0, fmt.Errorf("invalid sort: [%s]", value)
+		}
+	}
+	page = 1
+	if value := query.Get("page"); value != "" {
+		if page, err = strconv.Atoi(value); err != nil || page < 1 || page > respMaxPage {
+			return q, 0, fmt.Errorf("invalid page: [%s]", value)
+		}
+	}
+	for key := range query {
+		m := filterPattern.FindStringSubmatch(key)
+		if m == nil || query.Get(key) == "" {
+			continue
+		}
+		c, err := strconv.Atoi(m[1])
+		if err != nil {
+			return q, 0, fmt.Errorf("invalid filter: [%s]", key)
+		}
+		if q.Filters == nil {
+			q.Filters = map[int]string{}
+		}
+		q.Filters[c] = query.Get(key)
+	}
+	return q, page, nil
+}
+
+// validFilters is if the filters are of the columns of answers
+func validFilters(filters map[int]string, columns int) bool {
+	for c := range filters {
+		if c > columns {
+			return false
+		}
+	}
+	return true
+}
+
+// copyValues is a copy of the url values to change
+func copyValues(values url.Values) url.Values {
+	c := url.Values{}
+	for key, v := range values {
+		c[key] = append([]string(nil), v...)
+	}
+	return c
+}
+
+// formNumber is the form value as a number, nil if blank
+func formNumber(r *http.Request, key string) (*float64, error) {
+	value := strings.TrimSpace(r.FormValue(key))
+	if value == "" {
+		return nil, nil
+	}
+	f, ok := parseNumber(value)
+	if !ok {
+		return nil, fmt.Errorf("invalid %s: [%s]", key, value)
+	}
+	return &f, nil
+}
+
+// keyPattern is a prefill key e.g. email
+var keyPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// checkRules is feedback for the form maker if a rule cannot work
+func checkRules(formItems []models.FormItem) (feedback string) {
+	keys := map[string]bool{}
+	for i, formItem := range formItems {
+		if key := formItem.Key; key != "" {
+			if !keyPattern.MatchString(key) {
+				return fmt.Sprintf("%s: key must be letters, digits, _ or - and start with a letter", formItem.Label)
+			}
+			if keys[key] {
+				return fmt.Sprintf("%s: key %s is used by another item", formItem.Label, key)
+			}
+			keys[key] = true
+		}
+		rules := formItem.Rules
+		if _, err := regexp.Compile(rules.Pattern); err != nil {
+			return fmt.Sprintf("%s: pattern is not a valid regular expression", formItem.Label)
+		}
+		if rules.MaxLen != 0 && rules.MinLen > rules.MaxLen {
+			return fmt.Sprintf("%s: min length is more than max length", formItem.Label)
+		}
+		if rules.Min != nil && rules.Max != nil && *rules.Min > *rules.Max {
+			return fmt.Sprintf("%s: min is more than max", formItem.Label)
+		}
+		if show := formItem.Show; show != nil && show.Item >= i {
+			return fmt.Sprintf("%s: can only be shown by an answer before it", formItem.Label)
+		}
+		if show := formItem.Show; show != nil && formItems[show.Item].Label == "" {
+			return fmt.Sprintf("%s: is shown by an item with no label, which is not asked", formItem.Label)
+		}
+		if err := checkDefault(formItem); err != "" {
+			return fmt.Sprintf("%s: default answer %s", formItem.Label, err)
+		}
+		if rules.MaxKB > maxUploadSize>>10 {
+			return fmt.Sprintf("%s: max size is more than %d KB", formItem.Label, maxUploadSize>>10)
+		}
+	}
+	return ""
+}
+
+// pages is the page of each form item, a section starts a new page
+// (unless it is the first item), and the number of the last page
+func pages(formItems []models.FormItem) (pageOf []int, last int) {
+	pageOf = make([]int, len(formItems))
+	for i, formItem := range formItems {
+		if formItem.Type == "section" && i != 0 {
+			last++
+		}
+		pageOf[i] = last
+	}
+	return pageOf, last
+}
+
+// fileKeys are the uploaded files of the responses (by id) in the set
+func fileKeys(set models.ResponseSet, ids []int) (keys []string) {
+	for _, r := range set.TableData {
+		found := false
+		for _, id := range ids {
+			found = found || r.ID == id
+		}
+		if !found {
+			continue
+		}
+		for i, answer := range r.Data {
+			if set.IsFile(i) && answer.String() != "" {
+				keys = append(keys, answer.String())
+			}
+		}
+	}
+	return keys
+}
+
+// shown is which form items are shown given the answers, an item
+// is hidden if its condition is not met or the item it refers to
+// is hidden, the same as the javascript in the use page does
+func shown(formItems []models.FormItem, answers []answer) []bool {
+	shown := make([]bool, len(formItems))
+	for i, formItem := range formItems {
+		show := formItem.Show
+		if show == nil || show.Item < 0 || show.Item >= i {
+			shown[i] = true
+			continue
+		}
+		shown[i] = shown[show.Item] && answers[show.Item].matches(show.Value) != show.Not
+	}
+	return shown
+}
+
+// defaultAnswer is the answer to a form item before the respondent
+// changes it, e.g. options ticked in a checkboxes item
+func defaultAnswer(formItem models.FormItem) answer {
+	if formItem.Type == "checkboxes" {
+		var choices []string
+		for _, choice := range strings.Split(formItem.Default, ",") {
+			if choice = strings.TrimSpace(choice); choice != "" {
+				choices = append(choices, choice)
+			}
+		}
+		return answer{Values: choices}
+	}
+	return answer{Value: formItem.Default}
+}
+
+// prefilled is the answer to a form item from the url query, e.g.
+// /use/4?email=lam@bbq.com&sides=Rice&sides=Salad and if there is one
+func prefilled(formItem models.FormItem, query url.Values) (answer, bool) {
+	values, ok := query[formItem.Key]
+	if formItem.Key == "" || !ok || stringIs(formItem.Type, "file", "section") {
+		return answer{}, false
+	}
+	a := answer{Prefill: formItem.Prefill}
+	if formItem.Type == "checkboxes" {
+		a.Values = values
+	} else {
+		a.Value = values[0]
+	}
+	return a, true
+}
+
+// checkDefault is what is wrong with the default answer, "" if ok
+// a default does not have to be a required answer
+func checkDefault(formItem models.FormItem) string {
+	if formItem.Default == "" || stringIs(formItem.Type, "file", "section") {
+		return ""
+	}
+	if formItem.Type == "checkboxes" {
+		_, err := validateChoices(formItem, defaultAnswer(formItem).Values)
+		return err
+	}
+	if formItem.Type == "checkbox" {
+		if formItem.Default != "✅" {
+			return "must be ✅ (ticked) or blank"
+		}
+		return ""
+	}
+	_, err := validateAnswer(formItem, formItem.Default)
+	return err
+}
+
+// validateAnswer checks the answer to the form item is right for its
+// type and rules and returns the answer normalised for its type e.g. a
+// number 1.50 is 1.5, and what is wrong with the answer, "" if it is ok
+func validateAnswer(formItem models.FormItem, value string) (string, string) {
+	rules := formItem.Rules
+	if value == "" {
+		if rules.Required {
+			if formItem.Type == "checkbox" {
+				return value, "must be ticked"
+			}
+			return value, "required"
+		}
+		return value, ""
+	}
+	value, err := normalise(formItem.Type, value)
+	if err != "" {
+		return value, err
+	}
+	if hasOptions(formItem.Type) && !stringIs(value, formItem.Options...) {
+		return value, "must be one of the options"
+	}
+	length := utf8.RuneCountInString(value)
+	if rules.MinLen != 0 && length < rules.MinLen {
+		return value, fmt.Sprintf("must be at least %d characters", rules.MinLen)
+	}
+	if rules.MaxLen != 0 && length > rules.MaxLen {
+		return value, fmt.Sprintf("must be at most %d characters", rules.MaxLen)
+	}
+	if rules.Pattern != "" {
+		// like the html pattern attribute, the whole value must match
+		re, err := regexp.Compile("^(?:" + rules.Pattern + ")$")
+		if err == nil && !re.MatchString(value) {
+			return value, "is not in the right format"
+		}
+	}
+	if rules.Min != nil || rules.Max != nil {
+		f, ok := parseNumber(value)
+		if !ok {
+			return value, "must be a number"
+		}
+		if rules.Min != nil && f < *rules.Min {
+			return value, "must be at least " + models.FormatNumber(*rules.Min)
+		}
+		if rules.Max != nil && f > *rules.Max {
+			return value, "must be at most " + models.FormatNumber(*rules.Max)
+		}
+	}
+	return value, ""
+}
+
+// validateChoices checks the options ticked in a checkboxes form item
+// and returns them, and what is wrong with them, "" if they are ok
+func validateChoices(formItem models.FormItem, values []string) ([]string, string) {
+	var choices []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !stringIs(value, formItem.Options...) {
+			return choices, "must be one of the options"
+		}
+		choices = append(choices, value)
+	}
+	if len(choices) == 0 && formItem.Rules.Required {
+		return choices, "tick at least one"
+	}
+	return choices, ""
+}
+
+// validateFile checks the file uploaded for a file form item
+// and returns what is wrong with it, "" if it is ok
+func validateFile(formItem models.FormItem, file *multipart.FileHeader) string {
+	rules := formItem.Rules
+	if file == nil {
+		if rules.Required {
+			return "required"
+		}
+		return ""
+	}
+	if rules.MaxKB != 0 && file.Size > int64(rules.MaxKB)<<10 {
+		return fmt.Sprintf("must be at most %d KB", rules.MaxKB)
+	}
+	if rules.Accept != "" && !accepts(rules.Accept, file.Filename, file.Header.Get("Content-Type")) {
+		return "must be one of these types: " + rules.Accept
+	}
+	return ""
+}
+
+// accepts is if the file is one of the types, like the html accept
+// attribute, a type is a MIME type e.g. application/pdf or image/*
+// or a file name extension e.g. .pdf
+func accepts(types, filename, contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	for _, t := range strings.Split(strings.ToLower(types), ",") {
+		t = strings.TrimSpace(t)
+		switch {
+		case t == "":
+		case strings.HasPrefix(t, "."):
+			if strings.ToLower(path.Ext(filename)) == t {
+				return true
+			}
+		case strings.HasSuffix(t, "/*"):
+			if strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")) {
+				return true
+			}
+		case mediaType == t:
+			return true
+		}
+	}
+	return false
+}
+
+// fileName is the name of an uploaded file without the client's
+// directories, and for template.FuncMap the name from the file's key
+func fileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return "file"
+	}
+	return name
+}
+
+// for template.FuncMap, the download link of an uploaded file by its key
+// formid/uuid/name, the name escaped as it can have # ? or %
+func fileURL(key string) string {
+	dir, name := path.Split(key)
+	return "/file/" + dir + url.PathEscape(name)
+}
+
+// for template.FuncMap, the text with the start of the words that start
+// with a word searched for (see models.SearchWords) marked
+func highlight(words []string, text string) template.HTML {
+	var b strings.Builder
+	for text != "" {
+		// the text up to the next word, then the word
+		start := strings.IndexFunc(text, isWordRune)
+		if start == -1 {
+			start = len(text)
+		}
+		b.WriteString(template.HTMLEscapeString(text[:start]))
+		text = text[start:]
+		end := strings.IndexFunc(text, func(r rune) bool { return !isWordRune(r) })
+		if end == -1 {
+			end = len(text)
+		}
+		word := []rune(text[:end])
+		text = text[end:]
+		n := 0 // the runes marked, of the longest word searched for
+		lower := strings.ToLower(string(word))
+		for _, w := range words {
+			if strings.HasPrefix(lower, w) {
+				n = max(n, utf8.RuneCountInString(w))
+			}
+		}
+		if n = min(n, len(word)); n > 0 {
+			b.WriteString("<mark>" + template.HTMLEscapeString(string(word[:n])) + "</mark>")
+		}
+		b.WriteString(template.HTMLEscapeString(string(word[n:])))
+	}
+	return template.HTML(b.String())
+}
+
+// isWordRune is if r is part of a word, like models.SearchWords
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// normalise a (not blank) answer for the input type
+// and return what is wrong if it is not that type
+func normalise(inputType, value string) (string, string) {
+	switch inputType {
+	case "number":
+		f, ok := parseNumber(value)
+		if !ok {
+			return value, "must be a number"
+		}
+		return models.FormatNumber(f), ""
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Name != "" || !strings.Contains(addr.Address, "@") {
+			return value, "must be an email address"
+		}
+		// the domain is not case sensitive
+		at := strings.LastIndex(addr.Address, "@")
+		return addr.Address[:at] + strings.ToLower(addr.Address[at:]), ""
+	case "date":
+		d, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return value, "must be a date (yyyy-mm-dd)"
+		}
+		return d.Format("2006-01-02"), ""
+	case "time":
+		t, err := time.Parse("15:04", value)
+		if err != nil {
+			if t, err = time.Parse("15:04:05", value); err != nil {
+				return value, "must be a time (hh:mm)"
+			}
+			return t.Format("15:04:05"), ""
+		}
+		return t.Format("15:04"), ""
+	case "url":
+		u, err := url.ParseRequestURI(value)
+		if err != nil || u.Host == "" || !stringIs(strings.ToLower(u.Scheme), "http", "https") {
+			return value, "must be a web address (https://...)"
+		}
+		u.Scheme, u.Host = strings.ToLower(u.Scheme), strings.ToLower(u.Host)
+		return u.String(), ""
+	case "textarea":
+		return strings.ReplaceAll(value, "\r\n", "\n"), ""
+	}
+	return value, ""
+}
+
+// parseNumber is the value as a decimal number, like a number input
+// NaN, Inf and hex numbers that strconv.ParseFloat takes are not numbers
+func parseNumber(value string) (float64, bool) {
+	if strings.ContainsAny(value, "xX_") {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func isInputType(inputType string) bool {
+	for _, t := range inputTypes {
+		if inputType == t {
+			return true
+		}
+	}
+	return false
+}
+
 func stringIs(input string, ss ...string) bool {
 	for _, s := range ss {
 		if input == s {
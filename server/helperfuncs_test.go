@@ -0,0 +1,188 @@
+package main
+
+import (
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"forms/models"
+)
+
+func TestValidateAnswer(t *testing.T) {
+	one, ten := 1.0, 10.0
+	tests := []struct {
+		name, value, want, err string
+		formItem               models.FormItem
+	}{
+		{"Not required blank", "", "", "", models.FormItem{Type: "text"}},
+		{"Required blank", "", "", "required", models.FormItem{Type: "text", Rules: models.Rules{Required: true}}},
+		{"Required checkbox", "", "", "must be ticked", models.FormItem{Type: "checkbox", Rules: models.Rules{Required: true}}},
+		{"Min length", "ab", "ab", "must be at least 3 characters", models.FormItem{Type: "text", Rules: models.Rules{MinLen: 3}}},
+		{"Max length runes", "ééé", "ééé", "", models.FormItem{Type: "text", Rules: models.Rules{MaxLen: 3}}},
+		{"Max length", "abcd", "abcd", "must be at most 3 characters", models.FormItem{Type: "text", Rules: models.Rules{MaxLen: 3}}},
+		{"Pattern", "S1234567A", "S1234567A", "", models.FormItem{Type: "text", Rules: models.Rules{Pattern: `[STFG]\d{7}[A-Z]`}}},
+		{"Pattern whole value", "xS1234567A", "xS1234567A", "is not in the right format", models.FormItem{Type: "text", Rules: models.Rules{Pattern: `[STFG]\d{7}[A-Z]`}}},
+		{"Not a number", "two", "two", "must be a number", models.FormItem{Type: "text", Rules: models.Rules{Min: &one}}},
+		{"Below min", "0.5", "0.5", "must be at least 1", models.FormItem{Type: "text", Rules: models.Rules{Min: &one, Max: &ten}}},
+		{"Above max", "11", "11", "must be at most 10", models.FormItem{Type: "text", Rules: models.Rules{Min: &one, Max: &ten}}},
+		{"In range", "10", "10", "", models.FormItem{Type: "text", Rules: models.Rules{Min: &one, Max: &ten}}},
+		{"Number", "01.50", "1.5", "", models.FormItem{Type: "number"}},
+		{"Number range", "10.0", "10", "", models.FormItem{Type: "number", Rules: models.Rules{Max: &ten}}},
+		{"Not number", "1,000", "1,000", "must be a number", models.FormItem{Type: "number"}},
+		{"Number NaN", "NaN", "NaN", "must be a number", models.FormItem{Type: "number"}},
+		{"Number Inf", "-Inf", "-Inf", "must be a number", models.FormItem{Type: "number"}},
+		{"Number hex", "0x1p4", "0x1p4", "must be a number", models.FormItem{Type: "number"}},
+		{"NaN in range", "nan", "nan", "must be a number", models.FormItem{Type: "text", Rules: models.Rules{Min: &one, Max: &ten}}},
+		{"Email", "Lam@BBQ.Example.com", "Lam@bbq.example.com", "", models.FormItem{Type: "email"}},
+		{"Email with name", "Lam <lam@bbq.com>", "Lam <lam@bbq.com>", "must be an email address", models.FormItem{Type: "email"}},
+		{"Not email", "lam", "lam", "must be an email address", models.FormItem{Type: "email"}},
+		{"Date", "2020-12-01", "2020-12-01", "", models.FormItem{Type: "date"}},
+		{"Not date", "2020-02-30", "2020-02-30", "must be a date (yyyy-mm-dd)", models.FormItem{Type: "date"}},
+		{"Time", "09:30", "09:30", "", models.FormItem{Type: "time"}},
+		{"Time seconds", "09:30:15", "09:30:15", "", models.FormItem{Type: "time"}},
+		{"Not time", "9.30am", "9.30am", "must be a time (hh:mm)", models.FormItem{Type: "time"}},
+		{"URL", "HTTPS://Example.COM/Menu?q=1", "https://example.com/Menu?q=1", "", models.FormItem{Type: "url"}},
+		{"Not web URL", "ftp://example.com", "ftp://example.com", "must be a web address (https://...)", models.FormItem{Type: "url"}},
+		{"Textarea", "line 1\r\nline 2", "line 1\nline 2", "", models.FormItem{Type: "textarea"}},
+	}
+	for _, test := range tests {
+		value, err := validateAnswer(test.formItem, test.value)
+		if value != test.want || err != test.err {
+			t.Errorf("%s: got %q %q want %q %q", test.name, value, err, test.want, test.err)
+		}
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	body := "required1=on&minlen1=2&maxlen1=8&pattern1=[a-z]*&min1=-1.5&max1=&maxkb1=500&accept1=.pdf"
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	min := -1.5
+	want := models.Rules{Required: true, MinLen: 2, MaxLen: 8, Pattern: "[a-z]*", Min: &min, MaxKB: 500, Accept: ".pdf"}
+	rules, err := validateRules(r, 1)
+	if err != nil || !reflect.DeepEqual(rules, want) {
+		t.Errorf("got %+v %v want %+v", rules, err, want)
+	}
+	if rules, err = validateRules(r, 0); err != nil || !reflect.DeepEqual(rules, models.Rules{}) {
+		t.Errorf("item without rules: got %+v %v", rules, err)
+	}
+
+	r, _ = http.NewRequest("POST", "/", strings.NewReader(url.Values{"minlen0": {"-1"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err = validateRules(r, 0); err == nil {
+		t.Error("negative min length is not an error")
+	}
+	r, _ = http.NewRequest("POST", "/", strings.NewReader(url.Values{"max0": {"Inf"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if _, err = validateRules(r, 0); err == nil {
+		t.Error("infinite max is not an error")
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	pdf := &multipart.FileHeader{Filename: "Menu.PDF", Size: 2000, Header: textproto.MIMEHeader{"Content-Type": {"application/pdf"}}}
+	png := &multipart.FileHeader{Filename: "menu.png", Size: 2000, Header: textproto.MIMEHeader{"Content-Type": {"image/png"}}}
+	tests := []struct {
+		name, err string
+		file      *multipart.FileHeader
+		rules     models.Rules
+	}{
+		{"No file", "", nil, models.Rules{}},
+		{"Required", "required", nil, models.Rules{Required: true}},
+		{"Too large", "must be at most 1 KB", pdf, models.Rules{MaxKB: 1}},
+		{"Small enough", "", pdf, models.Rules{MaxKB: 2}},
+		{"Extension", "", pdf, models.Rules{Accept: ".pdf"}},
+		{"MIME type", "", pdf, models.Rules{Accept: "image/png, application/pdf"}},
+		{"MIME type wildcard", "", png, models.Rules{Accept: "image/*"}},
+		{"Not accepted", "must be one of these types: image/*,.doc", pdf, models.Rules{Accept: "image/*,.doc"}},
+	}
+	for _, test := range tests {
+		formItem := models.FormItem{Type: "file", Rules: test.rules}
+		if err := validateFile(formItem, test.file); err != test.err {
+			t.Errorf("%s: got %q want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	for name, want := range map[string]string{
+		"menu.pdf":              "menu.pdf",
+		`C:\Users\lam\menu.pdf`: "menu.pdf",
+		"../../menu.pdf":        "menu.pdf",
+		"4/uuid/menu.pdf":       "menu.pdf",
+		"..":                    "file",
+		"":                      "file",
+	} {
+		if got := fileName(name); got != want {
+			t.Errorf("fileName(%q) = %q want %q", name, got, want)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		text  string
+		words []string
+		want  string
+	}{
+		{"Lam's BBQ", []string{"lam"}, "<mark>Lam</mark>&#39;s BBQ"},
+		{"Ah Lam\nlamb <b>", []string{"la", "lam"}, "Ah <mark>Lam</mark>\n<mark>lam</mark>b &lt;b&gt;"},
+		{"Calamari", []string{"lam"}, "Calamari"},
+		{"Café crème", []string{"caf", "crè"}, "<mark>Caf</mark>é <mark>crè</mark>me"},
+		{"no search", nil, "no search"},
+	}
+	for _, test := range tests {
+		if got := highlight(test.words, test.text); string(got) != test.want {
+			t.Errorf("%q %q: got %q, want %q", test.text, test.words, got, test.want)
+		}
+	}
+}
+
+func TestShown(t *testing.T) {
+	formItems := []models.FormItem{
+		{Label: "Happy", Type: "select", Options: []string{"Yes", "No"}},
+		{Label: "Why", Type: "text", Show: &models.Condition{Item: 0, Value: "No"}},
+		{Label: "More", Type: "checkboxes", Show: &models.Condition{Item: 1, Not: true, Value: ""}},
+		{Label: "Later", Type: "text", Show: &models.Condition{Item: 4, Value: "x"}},
+		{Label: "Sides", Type: "checkboxes", Options: []string{"Rice", "Salad"}},
+		{Label: "Salad dressing", Type: "text", Show: &models.Condition{Item: 4, Value: "Salad"}},
+	}
+	tests := []struct {
+		name    string
+		answers []answer
+		want    []bool
+	}{
+		{"Condition met", []answer{{Value: "No"}, {Value: "sad"}, {}, {}, {Values: []string{"Rice", "Salad"}}, {}},
+			[]bool{true, true, true, true, true, true}},
+		{"Not met hides the items shown by it", []answer{{Value: "Yes"}, {Value: "sad"}, {}, {}, {}, {}},
+			[]bool{true, false, false, true, true, false}},
+		{"Not blank", []answer{{Value: "No"}, {}, {}, {}, {Values: []string{"Rice"}}, {}},
+			[]bool{true, true, false, true, true, false}},
+	}
+	for _, test := range tests {
+		if got := shown(formItems, test.answers); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMoveConditions(t *testing.T) {
+	formItems := []models.FormItem{
+		{Label: "a"},
+		{Label: "b", Show: &models.Condition{Item: 0, Value: "x"}},
+		{Label: "c", Show: &models.Condition{Item: 1, Value: "y"}},
+	}
+	// a deleted, b and c move up
+	moveConditions(formItems, func(old int) int { return old - 1 })
+	if formItems[1].Show != nil || formItems[2].Show.Item != 0 {
+		t.Errorf("got %v %v", formItems[1].Show, formItems[2].Show)
+	}
+	moveConditions(formItems, swap(0, 2))
+	if formItems[2].Show.Item != 2 {
+		t.Errorf("swap: got %v", formItems[2].Show)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"forms/models"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// viewHist lists the revisions of a form and shows the diff of
+// two of them if chosen (?a=revid&b=revid)
+func (app *application) viewHist(w http.ResponseWriter, r *http.Request) {
+	u := r.Context().Value(contextKey("user")).(models.User)
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "400 Invalid data", 400)
+		return
+	}
+	revisions, err := app.form.Revisions(id, u.ID)
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "500 Internal Server Error", 500)
+		return
+	}
+	if len(revisions) == 0 {
+		app.errorLog.Printf("form id:%v user:%v not found", id, u.Name)
+		http.Error(w, "404 Form not found", 404)
+		return
+	}
+
+	// revisions are newest first, diff is always older to newer
+	var a, b *models.Revision
+	aID, _ := strconv.Atoi(r.FormValue("a"))
+	bID, _ := strconv.Atoi(r.FormValue("b"))
+	for i := range revisions {
+		if revisions[i].ID == aID {
+			a = &revisions[i]
+		}
+		if revisions[i].ID == bID {
+			b = &revisions[i]
+		}
+	}
+	var diff []models.Change
+	compared := a != nil && b != nil
+	if compared {
+		if a.ID > b.ID {
+			a, b = b, a
+		}
+		diff = models.Diff(*a, *b)
+	}
+
+	pageData := struct {
+		models.Form
+		Revisions []models.Revision
+		A, B      *models.Revision
+		Compared  bool
+		Diff      []models.Change
+		models.User
+		PageMode int
+	}{models.Form{ID: id, Title: revisions[0].Title}, revisions, a, b, compared, diff, u, histMode}
+	err = app.tmpl.ExecuteTemplate(w, "form", pageData)
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "500 Internal Server Error", 500)
+		return
+	}
+}
+
+// restoreRev saves a revision as the form's latest, which is a new revision
+func (app *application) restoreRev(w http.ResponseWriter, r *http.Request) {
+	action := r.FormValue("action")
+	var rev int
+	var err error
+
+	if !stringIs(action, "choose", "auth") {
+		action, rev, err = getAction(action)
+		if err != nil {
+			app.errorLog.Print(err)
+			http.Error(w, "400 Invalid data", 400)
+			return
+		}
+	}
+
+	u := r.Context().Value(contextKey("user")).(models.User)
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "400 Invalid data", 400)
+		return
+	}
+
+	switch action {
+	case "res":
+		// demo mode does not save changes
+		if u.ID == 0 {
+			http.Redirect(w, r, "/login", 303)
+			return
+		}
+		revision, found, err := app.form.Revision(id, u.ID, rev)
+		if err != nil {
+			app.errorLog.Print(err)
+			http.Error(w, "500 Internal Server Error", 500)
+			return
+		}
+		if !found {
+			app.errorLog.Printf("form id:%v revision:%v user:%v not found", id, rev, u.Name)
+			http.Error(w, "404 Revision not found", 404)
+			return
+		}
+		err = app.form.Update(id, u.ID, revision.Title, revision.FormItems)
+		if err != nil {
+			app.errorLog.Print(err)
+			http.Error(w, "500 Internal Server Error", 500)
+			return
+		}
+		http.Redirect(w, r, "/edit/"+strconv.Itoa(id), 303)
+		return
+	case "choose":
+		http.Redirect(w, r, "/edit", 303)
+		return
+	case "auth":
+		if u.ID == 0 {
+			http.Redirect(w, r, "/login", 303)
+			return
+		}
+		http.Redirect(w, r, "/logout", 303)
+		return
+	}
+
+	http.Redirect(w, r, "/hist/"+strconv.Itoa(id), http.StatusSeeOther)
+}
@@ -1,7 +1,8 @@
 package main
 
 import (
-	"database/sql"
+	"flag"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
@@ -9,27 +10,16 @@ import (
 	"regexp"
 
 	"forms/models"
-	// already imported in models/userDB.go to use mysql.MySQLError types
-	// so no need to _ import just for the init() driver part
-	// _ "github.com/go-sql-driver/mysql"
 )
 
-type form interface {
-	GetAll(userid int) (forms []models.Form, err error)
-	New(userid int) (id int, err error)
-	Delete(id, userid int) error
-	Get(id, userid int) (title string, formItems []models.FormItem, found bool, err error)
-	Update(id, userid int, title string, formItems []models.FormItem) error
-	Use(id int) (title, updated string, formItems []models.FormItem, found bool, err error)
-	Check(id, userid int) (bool, error)
-}
-
 type application struct {
 	errorLog *log.Logger
 	infoLog  *log.Logger
-	user     models.UserDB
-	form
-	response models.ResponseDB
+	user     models.UserStore
+	form     models.FormStore
+	response models.ResponseStore
+	files    models.FileStore
+	uploads  *uploads // files uploaded to responses not sent yet
 	tmpl     *template.Template
 	re       *regexp.Regexp
 	session
@@ -39,37 +29,78 @@ func main() {
 	errorLog := log.New(os.Stderr, "error:\t", log.LstdFlags|log.Lshortfile)
 	infoLog := log.New(os.Stderr, "info:\t", log.LstdFlags)
 
+	demo := flag.Bool("demo", false, "run with an in memory store and sample forms, nothing is saved")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [-demo] [migrate]\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "  migrate\n    \tcreate or upgrade the database tables and exit")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "5000"
 	}
 
+	// the dsn scheme selects the storage driver e.g. mysql://...
+	// no scheme is a plain mysql dsn
 	dsn := os.Getenv("DSN")
 	if dsn == "" {
 		dsn = "formsSvr:password@(localhost:3306)/formsapp"
 	}
+	if *demo {
+		dsn = "memory://"
+	}
+
+	store, err := models.Open(dsn)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer store.Close()
 
-	db, err := openDB(dsn)
+	// the tables are upgraded on every start, migrate does just this
+	version, err := store.Migrate()
 	if err != nil {
 		errorLog.Fatal(err)
 	}
-	defer db.Close()
+	if flag.Arg(0) == "migrate" {
+		infoLog.Println("Database schema is at version", version)
+		return
+	}
+
+	// files uploaded with responses are kept in FILES_DIR
+	var files models.FileStore = models.NewMemFiles()
+	if *demo {
+		if err = addDemoForms(store.Form); err != nil {
+			errorLog.Fatal(err)
+		}
+	} else {
+		dir := os.Getenv("FILES_DIR")
+		if dir == "" {
+			dir = "./files"
+		}
+		if files, err = models.NewLocalFiles(dir); err != nil {
+			errorLog.Fatal(err)
+		}
+	}
 
-	tmpl, err := template.New("").Funcs(template.FuncMap{"minus1": minus1}).ParseGlob("./ui/html/*.tmpl")
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseGlob("./ui/html/*.tmpl")
 	if err != nil {
 		errorLog.Fatal(err)
 	}
 
-	re := regexp.MustCompile(`(^(add|del|upp|dwn|txt|cxb|sel)\d+$|^opt\d+ (add|del|upp|dwn)\d+$)`)
+	re := regexp.MustCompile(actionPattern)
 
 	s := session{sid: map[string]models.User{}, uid: map[int]string{}}
 
 	app := &application{
 		errorLog: errorLog,
 		infoLog:  infoLog,
-		user:     models.UserDB{DB: db},
-		form:     models.FormDB{DB: db},
-		response: models.ResponseDB{DB: db},
+		user:     store.User,
+		form:     store.Form,
+		response: store.Response,
+		files:    files,
+		uploads:  newUploads(),
 		tmpl:     tmpl,
 		re:       re,
 		session:  s,
@@ -91,15 +122,3 @@ func main() {
 	err = http.ListenAndServe(":"+port, app.routes())
 	errorLog.Fatal(err)
 }
-
-func openDB(dsn string) (*sql.DB, error) {
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
-	}
-
-	if err = db.Ping(); err != nil {
-		return nil, err
-	}
-	return db, nil
-}
@@ -1,28 +1,37 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"forms/models"
+	"html"
+	"io"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
-// This test is only for local dev enviroment
-// Should not be used with production/test environment
-// Unless url, numRquests(DB max conn), runs are changed appropriately
+// TestMainServer runs the server with the in memory store
+// so it does not need a database or a running dev server
 func TestMainServer(t *testing.T) {
 	// Makes e.g 150(numRequests) concurrent requests FOR e.g 10(runs) times
-	// default install of mysqld has 151 max DB connections
+	// with mysql, default install of mysqld has 151 max DB connections
 	// heroku jawsDB mysql has 10 max DB connections
 	// test hits max DB connection limit before server limit
-	const url = "http://localhost:5000"
-	const numRequests = 149 // i usually have another cli dev connection to DB
-	const runs = 1          // 1 for continuous tests to complete faster, tested 20 also works
-
-	// On my machine usually more than 20+ runs will hit server too many open files error
-	// But the server does not crash, errors are logged and next request works
-	// That's successful handling of 3000 (20 sequential, 150 concurrent) requests in short time
-	// its way more than expected and designed-for use case. so GO is good.
+	const numRequests = 150
+	const runs = 1 // 1 for continuous tests to complete faster, tested 20 also works
+
+	ts := httptest.NewServer(newTestApp(t).routes())
+	defer ts.Close()
+
 	for i := 0; i < runs; i++ {
-		errs := makeTestRequests(url, numRequests)
+		errs := makeTestRequests(ts.URL, numRequests)
 		if errs != 0 {
 			t.Errorf("%d/%d responses NOT 200 OK", errs, numRequests)
 		}
@@ -34,7 +43,12 @@ func makeTestRequests(url string, numRequests int) (errs int) {
 	result := []int{}
 	for i := 0; i < numRequests; i++ {
 		go func() {
-			r, _ := http.DefaultClient.Get(url)
+			r, err := http.DefaultClient.Get(url)
+			if err != nil {
+				c <- 0
+				return
+			}
+			r.Body.Close()
 			c <- r.StatusCode
 		}()
 	}
@@ -45,3 +59,753 @@ func makeTestRequests(url string, numRequests int) (errs int) {
 	}
 	return len(result)
 }
+
+// TestFormFlow goes through signup, creating and saving a form,
+// submitting a response to it and seeing the response
+func TestFormFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{
+		"title": {"Lam's BBQ"},
+		"label": {"Order", "Chilli"}, "type": {"select", "checkbox"}, "options0": {"Chicken", "Fish"},
+	})
+	// the demo forms are 1/2/3
+	if body := c.get("/edit"); !strings.Contains(body, `href="edit/4"`) {
+		t.Fatalf("new form not listed:\n%s", body)
+	}
+
+	version := formVersion(t, c.get("/use/4"))
+	body := c.post("/use/4", url.Values{"version": {version}, id[0]: {"Fish"}, id[1]: {"on"}})
+	if !strings.Contains(body, "Response Sent") {
+		t.Fatalf("no Response Sent feedback:\n%s", body)
+	}
+
+	body = c.get("/resp/4")
+	for _, s := range []string{"Lam&#39;s BBQ", "Order", "Fish", "✅"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("responses page missing %q", s)
+		}
+	}
+}
+
+// TestHistFlow saves edits of a form, compares and restores revisions
+func TestHistFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{"title": {"BBQ"}, "label": {"Order"}, "type": {"text"}})
+	c.post("/edit/4", url.Values{"action": {"view"}, "title": {"BBQ v2"}, "label": {"Orders"}, "type": {"text"}, "id": id})
+
+	// revisions 7 (New Form), 8 and 9 (the 2 edits)
+	// after the 3 demo forms which were made and then updated
+	body := c.get("/hist/4?a=9&b=8")
+	for _, s := range []string{"BBQ v2", "Item 1 Label", "Orders", "restore"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("history page missing %q", s)
+		}
+	}
+	body = c.post("/hist/4", url.Values{"action": {"res8"}})
+	if !strings.Contains(body, `value="BBQ"`) {
+		t.Errorf("revision not restored:\n%s", body)
+	}
+	body = c.get("/hist/4")
+	if n := strings.Count(body, `name="a"`); n != 4 {
+		t.Errorf("got %d revisions after restore, want 4", n)
+	}
+}
+
+// TestRulesFlow saves a form with rules and checks that answers
+// breaking them are shown again with what is wrong
+func TestRulesFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{
+		"title": {"BBQ"},
+		"label": {"Name", "Qty"}, "type": {"text", "text"},
+		"required0": {"on"}, "min1": {"1"}, "max1": {"10"},
+	})
+	body := c.get("/edit/4")
+	for _, s := range []string{`name="required0" value="on"`, `name="min1" value="1"`, `name="max1" value="10"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("rules not saved, missing %q", s)
+		}
+	}
+
+	version := formVersion(t, c.get("/use/4"))
+	body = c.post("/use/4", url.Values{"version": {version}, id[0]: {""}, id[1]: {"12"}})
+	for _, s := range []string{"required", "must be at most 10", `value="12"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("use page missing %q", s)
+		}
+	}
+	if body = c.get("/resp/4"); !strings.Contains(body, "No Responses Yet!") {
+		t.Error("invalid response was saved")
+	}
+}
+
+// TestChoicesFlow answers radio and checkboxes form items
+// and sees all the ticked options in the responses
+func TestChoicesFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{
+		"title": {"BBQ"},
+		"label": {"Size", "Sides"}, "type": {"radio", "checkboxes"},
+		"options0": {"Small", "Large"}, "options1": {"Rice", "Salad", "Fries"},
+		"required1": {"on"},
+	})
+
+	version := formVersion(t, c.get("/use/4"))
+	body := c.post("/use/4", url.Values{"version": {version}, id[0]: {"Large"}})
+	if !strings.Contains(body, "tick at least one") || !strings.Contains(body, `value="Large" checked`) {
+		t.Errorf("use page not shown again with what is wrong:\n%s", body)
+	}
+	body = c.post("/use/4", url.Values{"version": {version}, id[0]: {"Huge"}, id[1]: {"Rice"}})
+	if !strings.Contains(body, "must be one of the options") || !strings.Contains(body, `value="Rice" checked`) {
+		t.Errorf("use page not shown again with what is wrong:\n%s", body)
+	}
+	body = c.post("/use/4", url.Values{"version": {version}, id[0]: {"Large"}, id[1]: {"Rice", "Fries"}})
+	if !strings.Contains(body, "Response Sent") {
+		t.Fatalf("no Response Sent feedback:\n%s", body)
+	}
+
+	body = c.get("/resp/4")
+	if !strings.Contains(body, `<td class="answer">Large</td>`) || !strings.Contains(body, "<td class=\"answer\">Rice\nFries</td>") {
+		t.Errorf("responses page missing the answers:\n%s", body)
+	}
+}
+
+// TestFileFlow uploads a file with a response
+// and downloads it from the responses page
+func TestFileFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{
+		"title": {"Jobs"},
+		"label": {"Name", "CV"}, "type": {"text", "file"},
+		"required1": {"on"}, "maxkb1": {"1"}, "accept1": {".pdf"},
+	})
+
+	body := c.get("/use/4")
+	if !strings.Contains(body, `enctype="multipart/form-data"`) || !strings.Contains(body, `accept=".pdf"`) {
+		t.Fatalf("use page cannot upload files:\n%s", body)
+	}
+	form := url.Values{"version": {formVersion(t, body)}, id[0]: {"Lam"}}
+	body = c.postFiles("/use/4", form, upload{id[1], "cv.doc", "application/msword", "cv"})
+	if !strings.Contains(body, "must be one of these types: .pdf") {
+		t.Errorf("file type not checked:\n%s", body)
+	}
+	body = c.postFiles("/use/4", form, upload{id[1], "cv.pdf", "application/pdf", strings.Repeat("x", 2000)})
+	if !strings.Contains(body, "must be at most 1 KB") {
+		t.Errorf("file size not checked:\n%s", body)
+	}
+	body = c.postFiles("/use/4", form, upload{id[1], "my cv #1.pdf", "application/pdf", "%PDF-1.4"})
+	if !strings.Contains(body, "Response Sent") {
+		t.Fatalf("no Response Sent feedback:\n%s", body)
+	}
+
+	body = c.get("/resp/4")
+	link := regexp.MustCompile(`<a href="(/file/4/[^"]*/my%20cv%20%231.pdf)">my cv #1.pdf</a>`).FindStringSubmatch(body)
+	if link == nil {
+		t.Fatalf("no download link in responses:\n%s", body)
+	}
+	r, err := c.client.Get(c.url + link[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Body.Close()
+	b, _ := io.ReadAll(r.Body)
+	if r.StatusCode != 200 || string(b) != "%PDF-1.4" || !strings.HasPrefix(r.Header.Get("Content-Disposition"), "attachment") {
+		t.Errorf("download: %d %q %v", r.StatusCode, b, r.Header)
+	}
+
+	// only the owner of the form can download its files
+	if r, err = c.signup("kim").client.Get(c.url + link[1]); err != nil || r.StatusCode != 404 {
+		t.Errorf("download by another user: %v %v", r.StatusCode, err)
+	}
+}
+
+// TestUploadsFlow checks a response can only be sent with the files
+// uploaded while filling it in, and a file uploaded again is not saved again
+func TestUploadsFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{
+		"title": {"Jobs"}, "label": {"Name", "CV"}, "type": {"text", "file"}, "required0": {"on"}, "required1": {"on"},
+	})
+	version := formVersion(t, c.get("/use/4"))
+	uploaded := func(body string) (key, token string) {
+		k := regexp.MustCompile(`name="file` + id[1] + `" value="([^"]*)"`).FindStringSubmatch(body)
+		tok := regexp.MustCompile(`name="upload" value="([^"]*)"`).FindStringSubmatch(body)
+		if k == nil || tok == nil {
+			t.Fatalf("no file uploaded:\n%s", body)
+		}
+		return k[1], tok[1]
+	}
+	const madeUp = "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+
+	body := c.post("/use/4", url.Values{"version": {version}, "upload": {madeUp}, id[0]: {"Lam"}, "file" + id[1]: {"4/" + madeUp + "/cv.pdf"}})
+	if !strings.Contains(body, "required") || strings.Contains(body, "cv.pdf uploaded") {
+		t.Errorf("made up file key accepted:\n%s", body)
+	}
+
+	// the name is wrong, the file is kept and not saved again
+	form := url.Values{"version": {version}}
+	key, token := uploaded(c.postFiles("/use/4", form, upload{id[1], "cv.pdf", "application/pdf", "%PDF"}))
+	form.Set("upload", token)
+	if again, _ := uploaded(c.postFiles("/use/4", form, upload{id[1], "cv.pdf", "application/pdf", "%PDF"})); again != key {
+		t.Errorf("file saved again as %s, was %s", again, key)
+	}
+
+	form = url.Values{"version": {version}, "upload": {madeUp}, id[0]: {"Lam"}, "file" + id[1]: {key}}
+	if body = c.post("/use/4", form); !strings.Contains(body, "required") {
+		t.Errorf("file sent with another response:\n%s", body)
+	}
+	form.Set("upload", token)
+	if body = c.post("/use/4", form); !strings.Contains(body, "Response Sent") {
+		t.Fatalf("no Response Sent feedback:\n%s", body)
+	}
+	// the file is not pending after it is sent
+	if body = c.post("/use/4", form); !strings.Contains(body, "required") {
+		t.Errorf("file sent with a second response:\n%s", body)
+	}
+}
+
+// TestConditionsFlow shows a form item only for some answers
+// and checks hidden items are not required or saved
+func TestConditionsFlow(t *testing.T) {
+	c, _ := newFormClient(t, nil)
+	form := url.Values{
+		"action": {"view"}, "title": {"Survey"},
+		"label": {"Happy", "Why"}, "type": {"select", "text"},
+		"options0":  {"Yes", "No"},
+		"required1": {"on"}, "show1": {"0"}, "showvalue1": {"No"},
+	}
+	body := c.post("/edit/4", form)
+	if !strings.Contains(body, "(shown if item 1 is No)") {
+		t.Errorf("condition not shown in preview:\n%s", body)
+	}
+	id := itemIDs(body)
+
+	body = c.get("/use/4")
+	if !strings.Contains(body, `data-show-item="0" data-show-value="No"`) {
+		t.Errorf("use page missing condition:\n%s", body)
+	}
+	version := formVersion(t, body)
+	body = c.post("/use/4", url.Values{"version": {version}, id[0]: {"No"}, id[1]: {""}})
+	if !strings.Contains(body, "required") {
+		t.Errorf("shown item not checked:\n%s", body)
+	}
+	body = c.post("/use/4", url.Values{"version": {version}, id[0]: {"Yes"}, id[1]: {"sent anyway"}})
+	if !strings.Contains(body, "Response Sent") {
+		t.Fatalf("hidden item was checked:\n%s", body)
+	}
+	if body = c.get("/resp/4"); strings.Contains(body, "sent anyway") {
+		t.Errorf("hidden item answer was saved:\n%s", body)
+	}
+
+	// moving Why before Happy keeps the condition on Happy
+	form.Set("action", "upp1")
+	body = c.post("/edit/4", form)
+	if !regexp.MustCompile(`name="show0">\s*<option value="">always</option>\s*<option value="1" selected>`).MatchString(body) {
+		t.Errorf("condition not moved:\n%s", body)
+	}
+	body = c.post("/edit/4", url.Values{
+		"action": {"view"}, "title": {"Survey"},
+		"label": {"Why", "Happy"}, "type": {"text", "select"},
+		"options1": {"Yes", "No"}, "show0": {"1"}, "showvalue0": {"No"},
+	})
+	if !strings.Contains(body, "Why: can only be shown by an answer before it") {
+		t.Errorf("no feedback for a condition on a later item:\n%s", body)
+	}
+}
+
+// TestPagesFlow goes through a form of two pages with Next and Back
+// the response is only saved from the last page
+func TestPagesFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{
+		"title": {"BBQ"},
+		"label": {"Name", "Menu", "Order", "Dish", "Qty"}, "type": {"text", "file", "section", "select", "number"},
+		"required0": {"on"}, "options3": {"Chicken", "Fish"}, "max4": {"5"},
+	})
+
+	body := c.get("/use/4")
+	if !strings.Contains(body, `value="next">Next`) || strings.Contains(body, "Send") || !strings.Contains(body, "page 1 of 2") {
+		t.Fatalf("first page:\n%s", body)
+	}
+	version := formVersion(t, body)
+	body = c.post("/use/4", url.Values{"version": {version}, "page": {"0"}, "action": {"next"}})
+	if !strings.Contains(body, "required") || !strings.Contains(body, `name="page" value="0"`) {
+		t.Errorf("first page not checked:\n%s", body)
+	}
+
+	form := url.Values{"version": {version}, "page": {"0"}, "action": {"next"}, id[0]: {"Lam"}}
+	body = c.postFiles("/use/4", form, upload{id[1], "menu.pdf", "application/pdf", "%PDF"})
+	if !strings.Contains(body, "<h2>Order</h2>") || !strings.Contains(body, `name="page" value="1"`) ||
+		!strings.Contains(body, `<input type="hidden" name="`+id[0]+`" value="Lam">`) || !strings.Contains(body, "Send") {
+		t.Fatalf("second page:\n%s", body)
+	}
+	key := regexp.MustCompile(`name="file` + id[1] + `" value="(4/[^"]*/menu.pdf)"`).FindStringSubmatch(body)
+	token := regexp.MustCompile(`name="upload" value="([^"]*)"`).FindStringSubmatch(body)
+	if key == nil || token == nil {
+		t.Fatalf("uploaded file not kept:\n%s", body)
+	}
+
+	form = url.Values{"version": {version}, "page": {"1"}, "upload": {token[1]}, id[0]: {"Lam"}, "file" + id[1]: {key[1]}, id[3]: {"Fish"}, id[4]: {"9"}}
+	form.Set("action", "back")
+	body = c.post("/use/4", form)
+	if !strings.Contains(body, `name="page" value="0"`) || !strings.Contains(body, "menu.pdf uploaded") || strings.Contains(body, "must be at most 5") {
+		t.Errorf("back to first page:\n%s", body)
+	}
+	form.Set("action", "send")
+	body = c.post("/use/4", form)
+	if !strings.Contains(body, "must be at most 5") || !strings.Contains(body, `name="page" value="1"`) {
+		t.Errorf("last page not checked:\n%s", body)
+	}
+	form.Set(id[4], "2")
+	if body = c.post("/use/4", form); !strings.Contains(body, "Response Sent") {
+		t.Fatalf("no Response Sent feedback:\n%s", body)
+	}
+
+	body = c.get("/resp/4")
+	for _, s := range []string{`<td class="answer">Lam</td>`, ">menu.pdf</a>", `<td class="answer">Fish</td>`, `<td class="answer">2</td>`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("responses page missing %q", s)
+		}
+	}
+	if strings.Contains(body, "<td>Order</td>") {
+		t.Error("section saved as a form item")
+	}
+}
+
+// TestHelpFlow saves help text, placeholders and default answers
+// and sees them on the use page
+func TestHelpFlow(t *testing.T) {
+	c, _ := newFormClient(t, nil)
+	form := url.Values{
+		"action": {"view"}, "title": {"BBQ"},
+		"label": {"Name", "Size", "Sides"}, "type": {"text", "radio", "checkboxes"},
+		"help0": {"as on your IC"}, "placeholder0": {"Lam Tan"},
+		"options1": {"Small", "Large"}, "default1": {"Huge"},
+		"options2": {"Rice", "Salad", "Fries"}, "default2": {"Rice, Salad"},
+	}
+	body := c.post("/edit/4", form)
+	if !strings.Contains(body, "Size: default answer must be one of the options") {
+		t.Errorf("default not checked:\n%s", body)
+	}
+	form.Set("default1", "Large")
+	c.post("/edit/4", form)
+
+	body = c.get("/edit/4")
+	for _, s := range []string{`name="help0" value="as on your IC"`, `name="placeholder0" value="Lam Tan"`, `name="default2" value="Rice, Salad"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("not saved, missing %q", s)
+		}
+	}
+	body = c.get("/use/4")
+	for _, s := range []string{`placeholder="Lam Tan"`, `<small class="help">as on your IC</small>`,
+		`value="Large" checked`, `value="Rice" checked`, `value="Salad" checked`, `value="Fries" >`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("use page missing %q", s)
+		}
+	}
+}
+
+// TestPrefillFlow prefills a form from the link, a read only answer
+// is taken from the link and cannot be changed by the form
+func TestPrefillFlow(t *testing.T) {
+	c, _ := newFormClient(t, nil)
+	form := url.Values{
+		"action": {"view"}, "title": {"RSVP"},
+		"label": {"Name", "Email", "Ref"}, "type": {"text", "email", "text"},
+		"key0": {"name"}, "key1": {"email"}, "prefill1": {"readonly"},
+		"key2": {"name"}, "prefill2": {"hidden"},
+	}
+	body := c.post("/edit/4", form)
+	if !strings.Contains(body, "Ref: key name is used by another item") {
+		t.Errorf("no feedback for a duplicate key:\n%s", body)
+	}
+	form.Set("key2", "2")
+	body = c.post("/edit/4", form)
+	if !strings.Contains(body, "Ref: key must be letters") {
+		t.Errorf("no feedback for a bad key:\n%s", body)
+	}
+	form.Set("key2", "ref")
+	body = c.post("/edit/4", form)
+	if !strings.Contains(body, "(prefilled by ?email=, readonly)") {
+		t.Errorf("prefill not shown in preview:\n%s", body)
+	}
+	id := itemIDs(body)
+
+	link := "/use/4?name=Lam&email=lam@example.com&ref=x1"
+	body = c.get(link)
+	for _, s := range []string{`name="` + id[0] + `" value="Lam"`, `<strong>lam@example.com</strong>`, `name="` + id[2] + `" value="x1"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("use page missing %q", s)
+		}
+	}
+	version := formVersion(t, body)
+	body = c.post(link, url.Values{"version": {version}, id[0]: {"Lam Tan"}, id[1]: {"other@example.com"}, id[2]: {"x2"}})
+	if !strings.Contains(body, "Response Sent") || !strings.Contains(body, "lam@example.com") {
+		t.Fatalf("response not sent or prefill lost:\n%s", body)
+	}
+	body = c.get("/resp/4")
+	for _, s := range []string{"Lam Tan", "lam@example.com", "x1"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("response missing %q", s)
+		}
+	}
+	if strings.Contains(body, "other@example.com") || strings.Contains(body, "x2") {
+		t.Errorf("prefilled answers were changed:\n%s", body)
+	}
+}
+
+// TestItemIDsFlow checks form items keep their ids when they are
+// renamed or moved, and new items get new ids
+func TestItemIDsFlow(t *testing.T) {
+	c, _ := newFormClient(t, nil)
+	id := itemIDs(c.get("/edit/4"))
+	if len(id) != 3 || !models.ValidItemID(id[0]) || id[0] == id[1] {
+		t.Fatalf("new form item ids: %q", id)
+	}
+
+	form := url.Values{
+		"action": {"view"}, "title": {"BBQ"},
+		"label": {"Orders", "Name"}, "type": {"text", "text"}, "id": {id[2], id[0]},
+	}
+	if got := itemIDs(c.post("/edit/4", form)); !reflect.DeepEqual(got, []string{id[2], id[0]}) {
+		t.Errorf("ids after rename and move: %q", got)
+	}
+	form.Set("action", "add0")
+	got := itemIDs(c.post("/edit/4", form))
+	if len(got) != 3 || got[0] != id[2] || got[2] != id[0] || !models.ValidItemID(got[1]) || got[1] == id[0] || got[1] == id[2] {
+		t.Errorf("ids after add: %q", got)
+	}
+
+	form.Set("action", "view")
+	form["id"] = []string{id[0], id[0]}
+	r, err := c.client.PostForm(c.url+"/edit/4", form)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.StatusCode != 400 {
+		t.Errorf("duplicate ids: got %d, want 400", r.StatusCode)
+	}
+}
+
+// TestMergedFlow answers two versions of a form and sees the responses
+// in one table, an item renamed and moved is still one column
+func TestMergedFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{"title": {"BBQ"}, "label": {"Name", "Order"}, "type": {"text", "text"}})
+	v1 := formVersion(t, c.get("/use/4"))
+	c.post("/use/4", url.Values{"version": {v1}, id[0]: {"Lam"}, id[1]: {"Fish"}})
+
+	// the second version, Order renamed Dish and moved first, is seeded in
+	// the store as versions are by the second and the test is quicker
+	t2, err := time.Parse("2006-01-02 15:04:05", v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := t2.Add(time.Second).Format("2006-01-02 15:04:05")
+	err = c.app.response.New(models.PostResponse{
+		FormID: 4, Version: v2, Title: "BBQ",
+		FormKeys: []string{"Dish", "Name", "Qty"}, FormTypes: []string{"text", "text", "number"},
+		ItemIDs:    []string{id[1], id[0], models.NewItemID(nil)},
+		FormValues: []models.Answer{{"Beef"}, {"Kim"}, {"2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the table of the latest version is shown, the other links to its table
+	body := c.get("/resp/4")
+	show := regexp.MustCompile(`<a href="([^"]*)">show the responses</a>`).FindAllStringSubmatch(body, -1)
+	if strings.Count(body, "<table>") != 1 || !strings.Contains(body, "?view=merged") || len(show) != 1 {
+		t.Fatalf("not a table per version:\n%s", body)
+	}
+	if body = c.get(html.UnescapeString(show[0][1])); strings.Count(body, "<table>") != 1 || !strings.Contains(body, `<td class="answer">Lam</td>`) || !strings.Contains(body, v1) {
+		t.Errorf("not the table of the first version:\n%s", body)
+	}
+	body = c.get("/resp/4?view=merged")
+	if strings.Count(body, "<table>") != 1 || !strings.Contains(body, "all versions") {
+		t.Fatalf("not one table:\n%s", body)
+	}
+	cells := regexp.MustCompile(`<td(?: class="answer")?>([^<]*|<a [^>]*>[^<]*</a>[ ▲▼]*)</td>`).FindAllStringSubmatch(body, -1)
+	var got []string
+	for _, cell := range cells {
+		got = append(got, regexp.MustCompile(`<[^>]*>`).ReplaceAllString(cell[1], ""))
+	}
+	// the header (sorted by created), then the first response without the created time
+	want := []string{"", "Dish", "Name", "Qty", "version", "created ▲", "Fish", "Lam", "", v1}
+	if len(got) != 16 || !reflect.DeepEqual(got[:10], want) || got[11] != "Beef" {
+		t.Errorf("merged table cells %q, want %q...", got, want)
+	}
+}
+
+// TestBrowseRespFlow pages through the responses of a version, sorted by
+// a column and filtered, and of all the versions merged, and searches them
+func TestBrowseRespFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{"title": {"BBQ"}, "label": {"Name", "Qty"}, "type": {"text", "number"}})
+	version := formVersion(t, c.get("/use/4"))
+	for i := 1; i <= respPageSize+1; i++ {
+		name := fmt.Sprintf("guest %02d", i)
+		if i%10 == 0 {
+			name = fmt.Sprintf("Lam %02d", i)
+		}
+		c.post("/use/4", url.Values{"version": {version}, id[0]: {name}, id[1]: {strconv.Itoa(i)}})
+	}
+	names := regexp.MustCompile(`<td class="answer">(guest|Lam) (\d\d)</td>`)
+	first := func(body string) string {
+		if m := names.FindStringSubmatch(body); m != nil {
+			return m[2]
+		}
+		return ""
+	}
+
+	body := c.get("/resp/4")
+	if n := len(names.FindAllString(body, -1)); n != respPageSize || first(body) != "01" {
+		t.Errorf("first page: %d responses from %s", n, first(body))
+	}
+	if !strings.Contains(body, fmt.Sprintf("responses 1 to %d of %d", respPageSize, respPageSize+1)) || !strings.Contains(body, "page=2") {
+		t.Errorf("no page links:\n%s", body)
+	}
+	v := url.QueryEscape(version)
+	body = c.get("/resp/4?version=" + v + "&page=2")
+	if n := len(names.FindAllString(body, -1)); n != 1 || first(body) != fmt.Sprint(respPageSize+1) {
+		t.Errorf("second page: %d responses from %s", n, first(body))
+	}
+	// the numbers are sorted as numbers, 9 before 10
+	if body = c.get("/resp/4?version=" + v + "&sort=2&desc=1"); first(body) != fmt.Sprint(respPageSize+1) || !strings.Contains(body, "▼") {
+		t.Errorf("sorted by qty desc from %s", first(body))
+	}
+	body = c.get("/resp/4?version=" + v + "&sort=1&f1=lam")
+	if got := names.FindAllStringSubmatch(body, -1); len(got) != 5 || got[0][2] != "10" || !strings.Contains(body, `value="lam"`) {
+		t.Errorf("filtered: %q", got)
+	}
+	if body = c.get("/resp/4?view=merged&desc=1"); first(body) != fmt.Sprint(respPageSize+1) {
+		t.Errorf("merged newest first from %s", first(body))
+	}
+	// the search is of all the answers, the words found are marked
+	body = c.get("/resp/4?q=LAM+2")
+	if n := strings.Count(body, `<td class="answer"><mark>Lam</mark> <mark>2</mark>0</td>`); n != 1 || strings.Count(body, "<mark>") != 3 {
+		t.Errorf("search: %d found\n%s", n, body)
+	}
+	if !strings.Contains(body, `value="LAM 2"`) || !strings.Contains(body, "responses 1 to 1 of 1") {
+		t.Errorf("search box or count:\n%s", body)
+	}
+	for path, code := range map[string]int{
+		"/resp/4?version=" + v + "&sort=4":    400, // Name, Qty, created
+		"/resp/4?version=" + v + "&f3=2020":   400,
+		"/resp/4?page=0":                      400,
+		"/resp/4?page=922337203685477581":     400, // the offset overflows
+		"/resp/4?version=2000-01-01+00:00:00": 404,
+	} {
+		r, err := c.client.Get(c.url + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != code {
+			t.Errorf("%s: got %d, want %d", path, r.StatusCode, code)
+		}
+	}
+}
+
+// TestSummaryFlow shows the statistics of the answers of each type
+func TestSummaryFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{
+		"title": {"BBQ"},
+		"label": {"Order", "Chilli", "Qty", "Name"}, "type": {"select", "checkbox", "number", "text"}, "options0": {"Chicken", "Fish", "Beef"},
+	})
+	version := formVersion(t, c.get("/use/4"))
+	for _, answers := range [][]string{{"Fish", "on", "1", "Lam"}, {"Fish", "", "5", "Tan"}, {"Chicken", "", "", "Lam"}} {
+		c.post("/use/4", url.Values{"version": {version}, id[0]: {answers[0]}, id[1]: {answers[1]}, id[2]: {answers[2]}, id[3]: {answers[3]}})
+	}
+
+	if body := c.get("/resp/4"); !strings.Contains(body, `href="/resp/4?view=summary"`) {
+		t.Errorf("no summary link:\n%s", body)
+	}
+	body := c.get("/resp/4?view=summary")
+	for _, want := range []string{
+		"3 responses",
+		"<tr><td>Fish</td><td>2</td><td>67%</td></tr>",
+		"<tr><td>Beef</td><td>0</td><td>0%</td></tr>", // not picked
+		"<tr><td>ticked</td><td>1</td><td>33%</td></tr>",
+		"<p><b>Qty</b> answered by 2 of 3</p>",
+		"min 1, max 5, mean 3",
+		"<tr><td>Lam</td><td>2</td><td>67%</td></tr>",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("summary missing %q", want)
+		}
+	}
+	if strings.Contains(body, `name="sel"`) {
+		t.Errorf("summary has the response table:\n%s", body)
+	}
+	// a chart of the responses per day, and of the select and checkbox
+	if n := strings.Count(body, "<svg "); n != 3 || !regexp.MustCompile(`href="/resp/4/chart\?version=[^"&]+&column=2"`).MatchString(body) {
+		t.Errorf("%d charts in the summary:\n%s", n, body)
+	}
+
+	for path, status := range map[string]int{
+		"/resp/4/chart": 200, "/resp/4/chart?column=1": 200, "/resp/4/chart?column=2": 200,
+		"/resp/4/chart?column=3": 404, "/resp/4/chart?column=9": 404, "/resp/4/chart?version=nope": 404, "/resp/1/chart": 404,
+	} {
+		r, err := c.client.Get(c.url + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		if r.StatusCode != status {
+			t.Errorf("%s: got %d, want %d", path, r.StatusCode, status)
+			continue
+		}
+		if status == 200 && (r.Header.Get("Content-Type") != "image/svg+xml" || !strings.HasPrefix(string(b), "<svg ")) {
+			t.Errorf("%s: not an svg download %q:\n%s", path, r.Header.Get("Content-Type"), b)
+		}
+	}
+}
+
+// TestDeleteRespFlow deletes a response, the ticked responses and all
+// the responses to a version, and the files uploaded with them
+func TestDeleteRespFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{"title": {"Jobs"}, "label": {"Name", "CV"}, "type": {"text", "file"}})
+	version := formVersion(t, c.get("/use/4"))
+	for _, name := range []string{"Lam", "Kim", "Tan", "Lee"} {
+		c.postFiles("/use/4", url.Values{"version": {version}, id[0]: {name}}, upload{id[1], name + ".pdf", "application/pdf", "%PDF"})
+	}
+	body := c.get("/resp/4")
+	responses := regexp.MustCompile(`name="sel" value="(\d+)"`).FindAllStringSubmatch(body, -1)
+	link := regexp.MustCompile(`<a href="(/file/4/[^"]*)">Lam.pdf</a>`).FindStringSubmatch(body)
+	if len(responses) != 4 || link == nil || !strings.Contains(body, `value="ver `+version+`"`) {
+		t.Fatalf("responses page:\n%s", body)
+	}
+
+	// another user cannot delete the responses
+	r, err := c.signup("kim").client.PostForm(c.url+"/resp/4", url.Values{"action": {"del" + responses[0][1]}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.StatusCode != 404 {
+		t.Errorf("delete by another user: got %d, want 404", r.StatusCode)
+	}
+
+	// nothing ticked deletes nothing, not the files of all the responses
+	body = c.post("/resp/4", url.Values{"action": {"sel"}})
+	if !strings.Contains(body, "No responses ticked") || len(regexp.MustCompile(`name="sel" value="\d+"`).FindAllString(body, -1)) != 4 {
+		t.Errorf("responses deleted with none ticked:\n%s", body)
+	}
+	if r, err = c.client.Get(c.url + link[1]); err != nil || r.StatusCode != 200 {
+		t.Errorf("file deleted with none ticked: %v %v", r.StatusCode, err)
+	}
+	r.Body.Close()
+
+	body = c.post("/resp/4", url.Values{"action": {"del" + responses[0][1]}})
+	if !strings.Contains(body, "Responses deleted") || strings.Contains(body, "Lam.pdf") || !strings.Contains(body, "Kim.pdf") {
+		t.Errorf("response not deleted:\n%s", body)
+	}
+	if r, err = c.client.Get(c.url + link[1]); err != nil || r.StatusCode != 404 {
+		t.Errorf("file of deleted response: %v %v", r.StatusCode, err)
+	}
+	// the page the responses are deleted from is shown after
+	back := url.Values{"version": {version}, "page": {"1"}, "sort": {"1"}, "desc": {"1"}, "f1": {"e"}}
+	if body = c.get("/resp/4?" + back.Encode()); !strings.Contains(body, `name="back" value="desc=1&amp;f1=e&amp;page=1&amp;sort=1&amp;version=`) {
+		t.Errorf("no query to come back to:\n%s", body)
+	}
+	r, err = c.client.PostForm(c.url+"/resp/4", url.Values{"action": {"sel"}, "sel": {responses[1][1], responses[2][1]}, "back": {back.Encode()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	if body = string(b); strings.Contains(body, "Kim.pdf") || strings.Contains(body, "Tan.pdf") || !strings.Contains(body, "Lee.pdf") {
+		t.Errorf("ticked responses not deleted:\n%s", body)
+	}
+	if r.Request.URL.RawQuery != back.Encode() || !strings.Contains(body, `value="e"`) {
+		t.Errorf("deleted from %q, back at %q", back.Encode(), r.Request.URL.RawQuery)
+	}
+	r, err = c.client.PostForm(c.url+"/resp/4", url.Values{"action": {"del" + responses[0][1]}, "back": {"page=0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Body.Close()
+	if r.Request.URL.RequestURI() != "/resp/4" {
+		t.Errorf("back to an invalid page: %s", r.Request.URL)
+	}
+	for action, code := range map[string]int{"ver-1": 400, "del-1": 400, "ver 2000-01-01 00:00:00": 404} {
+		r, err := c.client.PostForm(c.url+"/resp/4", url.Values{"action": {action}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != code {
+			t.Errorf("%s: got %d, want %d", action, r.StatusCode, code)
+		}
+	}
+	body = c.post("/resp/4", url.Values{"action": {"ver " + version}})
+	if !strings.Contains(body, "No Responses Yet!") {
+		t.Errorf("version not deleted:\n%s", body)
+	}
+}
+
+// TestExportFlow downloads the responses as csv, json, ndjson and xlsx, of
+// all the versions and of one version, only the owner of the form can
+func TestExportFlow(t *testing.T) {
+	c, id := newFormClient(t, url.Values{
+		"title": {"Lam's BBQ"}, "label": {"Name", "Sides"}, "type": {"text", "checkboxes"},
+		"options1": {"Rice", "Fries"},
+	})
+	version := formVersion(t, c.get("/use/4"))
+	c.post("/use/4", url.Values{"version": {version}, id[0]: {"Lam, Tan"}, id[1]: {"Rice", "Fries"}})
+
+	if body := c.get("/resp/4"); !strings.Contains(body, `href="/resp/4/export?format=csv"`) {
+		t.Errorf("no csv download link:\n%s", body)
+	}
+	r, err := c.client.Get(c.url + "/resp/4/export?format=csv&bom=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	want := "\ufeffName,Sides,version,created\n\"Lam, Tan\",\"Rice\nFries\"," + version + ","
+	if r.StatusCode != 200 || !strings.HasPrefix(string(b), want) {
+		t.Errorf("csv: %d %q, want %q...", r.StatusCode, b, want)
+	}
+	if got := r.Header.Get("Content-Disposition"); got != `attachment; filename="Lam's BBQ.csv"` {
+		t.Errorf("csv file name: %s", got)
+	}
+
+	body := c.get("/resp/4/export?format=csv&version=" + url.QueryEscape(version))
+	if !strings.HasPrefix(body, "Name,Sides,created\n") {
+		t.Errorf("csv of a version: %q", body)
+	}
+
+	var records []exportRecord
+	if err = json.Unmarshal([]byte(c.get("/resp/4/export?format=json")), &records); err != nil || len(records) != 1 {
+		t.Fatalf("json: %v %v", err, records)
+	}
+	if rec := records[0]; rec.FormID != 4 || rec.Version != version || rec.Created == "" ||
+		!reflect.DeepEqual(rec.Answers, map[string]models.Answer{"Name": {"Lam, Tan"}, "Sides": {"Rice", "Fries"}}) {
+		t.Errorf("json record: %+v", rec)
+	}
+	if body = c.get("/resp/4/export?format=ndjson"); strings.Count(body, "\n") != 1 || !strings.HasPrefix(body, `{"id":`) {
+		t.Errorf("ndjson: %q", body)
+	}
+	if r, err = c.client.Get(c.url + "/resp/4/export?format=xlsx"); err != nil {
+		t.Fatal(err)
+	}
+	b, _ = io.ReadAll(r.Body)
+	r.Body.Close()
+	if ct := r.Header.Get("Content-Type"); r.StatusCode != 200 || !strings.Contains(ct, "spreadsheetml") {
+		t.Errorf("xlsx: %d %s", r.StatusCode, ct)
+	}
+	if sheet := readXLSX(t, b)["xl/worksheets/sheet1.xml"]; !strings.Contains(sheet, "Lam, Tan") {
+		t.Errorf("xlsx sheet: %s", sheet)
+	}
+	for path, code := range map[string]int{
+		"/resp/4/export?version=2000-01-01+00:00:00": 404,
+		"/resp/4/export?format=doc":                  400,
+		"/resp/1/export":                             404, // a demo form
+		"/resp/1/export?format=json":                 404,
+		"/resp/1/export?format=ndjson":               404,
+		"/resp/1/export?format=xlsx":                 404,
+	} {
+		if r, err = c.client.Get(c.url + path); err != nil {
+			t.Fatal(err)
+		}
+		r.Body.Close()
+		if r.StatusCode != code {
+			t.Errorf("%s: got %d, want %d", path, r.StatusCode, code)
+		}
+	}
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"errors"
 	"forms/models"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"strings"
 
+	"github.com/google/uuid"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -40,44 +48,193 @@ func (app *application) useForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the form is in pages split by sections, answers on the other pages
+	// are kept in hidden inputs. Each page is checked before going to the
+	// next and the response is saved after the last page
+	answers := make([]answer, len(formItems))
+	query := r.URL.Query()
+	for i, formItem := range formItems {
+		answers[i] = defaultAnswer(formItem)
+		if a, ok := prefilled(formItem, query); ok {
+			answers[i] = a
+		}
+	}
+	pageOf, lastPage := pages(formItems)
+	page, token := 0, ""
 	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		err = r.ParseMultipartForm(1 << 20)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "413 Files are too large", 413)
+			return
+		}
+		if err != nil && err != http.ErrNotMultipart {
+			app.errorLog.Print(err)
+			http.Error(w, "400 Invalid data", 400)
+			return
+		}
 		version := r.FormValue("version")
 		if version != updated {
 			http.Error(w, "400 Invalid Data or Form has changed", 400)
 			return
 		}
-		keys, values := []string{}, []string{}
+		page, _ = strconv.Atoi(r.FormValue("page")) // none is the first page
+		if page < 0 || page > lastPage {
+			http.Error(w, "400 Invalid data", 400)
+			return
+		}
+		action := r.FormValue("action")
+		token = uploadToken(r.PostFormValue("upload"))
+
+		files := map[int]*multipart.FileHeader{} // by form item index
 		for index, formItem := range formItems {
-			if formItem.Label == "" {
+			if formItem.Label == "" || formItem.Type == "section" {
 				continue
 			}
-			keys = append(keys, formItem.Label)
-			value := strings.TrimSpace(r.FormValue(strconv.Itoa(index)))
-			if formItem.Type == "checkbox" && value == "on" {
-				value = "✅"
+			// the answers are named by the form item id, only the posted
+			// values are read as the url has the prefill keys
+			name := formItem.ID
+			values := r.PostForm[name]
+			// the answers prefilled from the url that cannot be changed
+			// are from the url (which the form posts to) not the form
+			prefill := answers[index].Prefill
+			if prefill != "" {
+				values = query[formItem.Key]
+			}
+			switch formItem.Type {
+			case "file":
+				if r.MultipartForm != nil && len(r.MultipartForm.File[name]) != 0 {
+					files[index] = r.MultipartForm.File[name][0]
+					answers[index] = answer{Err: validateFile(formItem, files[index])}
+					break
+				}
+				// a file uploaded before with this response
+				if key := r.PostFormValue("file" + name); app.uploaded(token, id, name, key) {
+					answers[index] = answer{Value: key}
+					break
+				}
+				answers[index] = answer{Err: validateFile(formItem, nil)}
+			case "checkboxes":
+				choices, err := validateChoices(formItem, values)
+				answers[index] = answer{Values: choices, Err: err, Prefill: prefill}
+			default:
+				value := ""
+				if len(values) != 0 {
+					value = values[0]
+				}
+				value, err := validateAnswer(formItem, strings.TrimSpace(value))
+				if formItem.Type == "checkbox" && value == "on" {
+					value = "✅"
+				}
+				answers[index] = answer{Value: value, Err: err, Prefill: prefill}
 			}
-			values = append(values, value)
 		}
 
-		resp := models.PostResponse{
-			FormID:     id,
-			Version:    version,
-			Title:      title,
-			FormKeys:   keys,
-			FormValues: values,
+		// hidden items are not checked and their answers are not saved
+		// going back does not check, the last page checks all the pages
+		visible := shown(formItems, answers)
+		wrongPage := -1
+		for index := range formItems {
+			checked := action != "back" && (page == lastPage || pageOf[index] == page)
+			if !visible[index] || !checked {
+				answers[index].Err = ""
+				continue
+			}
+			if answers[index].Err != "" && wrongPage == -1 {
+				wrongPage = pageOf[index]
+			}
 		}
-		if err := app.response.New(resp); err != nil {
-			app.errorLog.Print(err)
-			http.Error(w, "500 Internal Server Error", 500)
+
+		// files that are ok are saved now, so they are not uploaded again
+		// they are deleted if the response is not sent (see uploads)
+		for index, file := range files {
+			if !visible[index] || answers[index].Err != "" {
+				continue
+			}
+			if token == "" {
+				token = uuid.New().String()
+			}
+			key, err := app.saveUpload(token, id, formItems[index].ID, file)
+			if errors.Is(err, errTooManyUploads) {
+				http.Error(w, "503 Too many uploads, please try again later", 503)
+				return
+			}
+			if err != nil {
+				app.errorLog.Print(err)
+				http.Error(w, "500 Internal Server Error", 500)
+				return
+			}
+			answers[index].Value = key
+		}
+
+		switch {
+		case action == "back":
+			if page > 0 {
+				page--
+			}
+		case wrongPage != -1:
+			// show the form again with the answers and what is wrong
+			page = wrongPage
+			feedback = "Please correct the answers marked below"
+		case page < lastPage:
+			page++
+		default:
+			keys, types, ids, values, fileKeys := []string{}, []string{}, []string{}, []models.Answer{}, []string{}
+			for index, formItem := range formItems {
+				if formItem.Label == "" || formItem.Type == "section" {
+					continue
+				}
+				keys = append(keys, formItem.Label)
+				types = append(types, formItem.Type)
+				ids = append(ids, formItem.ID)
+				switch {
+				case !visible[index]:
+					values = append(values, nil)
+				case formItem.Type == "checkboxes":
+					values = append(values, models.Answer(answers[index].Values))
+				default:
+					values = append(values, models.Answer{answers[index].Value})
+				}
+				if visible[index] && formItem.Type == "file" && answers[index].Value != "" {
+					fileKeys = append(fileKeys, answers[index].Value)
+				}
+			}
+			resp := models.PostResponse{
+				FormID:     id,
+				Version:    version,
+				Title:      title,
+				FormKeys:   keys,
+				FormTypes:  types,
+				ItemIDs:    ids,
+				FormValues: values,
+			}
+			// the files are the response's, once, before it is saved
+			if !app.sendUploads(token, fileKeys) {
+				http.Error(w, "400 Invalid data", 400)
+				return
+			}
+			if err := app.response.New(resp); err != nil {
+				app.errorLog.Print(err)
+				app.deleteFiles(fileKeys)
+				http.Error(w, "500 Internal Server Error", 500)
+				return
+			}
+			setFeedback(w, "Response Sent")
+			// the next response is prefilled the same
+			http.Redirect(w, r, r.URL.RequestURI(), 303)
 			return
 		}
-		setFeedback(w, "Response Sent")
-		http.Redirect(w, r, "/use/"+strconv.Itoa(id), 303)
 	}
 
 	pageData := pageData{
 		Form:     models.Form{ID: id, Title: title, FormItems: formItems, Updated: updated},
 		Feedback: feedback,
+		Answers:  answers,
+		Page:     page,
+		PageOf:   pageOf,
+		LastPage: lastPage,
+		Upload:   token,
 	}
 	err = app.tmpl.ExecuteTemplate(w, "use", pageData)
 	if err != nil {
@@ -87,9 +244,33 @@ func (app *application) useForm(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (app *application) viewResp(w http.ResponseWriter, r *http.Request) {
+// saveFile saves an uploaded file of a response to form id
+// and returns its key e.g. 4/<uuid>/menu.pdf
+func (app *application) saveFile(id int, file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	key := strconv.Itoa(id) + "/" + uuid.New().String() + "/" + fileName(file.Filename)
+	return key, app.files.Put(key, f)
+}
+
+// deleteFiles of responses that could not be saved or were deleted
+// the responses are gone, files left behind are only logged
+func (app *application) deleteFiles(keys []string) {
+	for _, key := range keys {
+		if err := app.files.Delete(key); err != nil {
+			app.errorLog.Print(err)
+		}
+	}
+}
+
+// getFile downloads a file uploaded with a response to a form of the user
+func (app *application) getFile(w http.ResponseWriter, r *http.Request) {
 	u := r.Context().Value(contextKey("user")).(models.User)
-	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	params := httprouter.ParamsFromContext(r.Context())
+	id, err := strconv.Atoi(params.ByName("id"))
 	if err != nil {
 		app.errorLog.Print(err)
 		http.Error(w, "400 Invalid data", 400)
@@ -106,17 +287,268 @@ func (app *application) viewResp(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "404 Form not found", 404)
 		return
 	}
-	versions, err := app.response.Get(id)
+	name := params.ByName("name")
+	f, err := app.files.Get(strconv.Itoa(id) + "/" + params.ByName("uuid") + "/" + name)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, "404 File not found", 404)
+		return
+	}
 	if err != nil {
 		app.errorLog.Print(err)
 		http.Error(w, "500 Internal Server Error", 500)
 		return
 	}
+	defer f.Close()
+
+	// always a download, an uploaded html file must not run on this site
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	if _, err = io.Copy(w, f); err != nil {
+		app.errorLog.Print(err)
+	}
+}
+
+// ownForm is the id, title and items of the form (by the id in the url)
+// of the user, or it writes the error and ok is false
+func (app *application) ownForm(w http.ResponseWriter, r *http.Request) (id int, title string, formItems []models.FormItem, ok bool) {
+	u := r.Context().Value(contextKey("user")).(models.User)
+	id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "400 Invalid data", 400)
+		return
+	}
+	title, formItems, found, err := app.form.Get(id, u.ID)
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "500 Internal Server Error", 500)
+		return
+	}
+	if !found {
+		app.errorLog.Printf("form id:%v user:%v not found", id, u.Name)
+		http.Error(w, "404 Form not found", 404)
+		return
+	}
+	return id, title, formItems, true
+}
+
+// respPageSize is the number of responses on a page of a response table
+const respPageSize = 50
+
+// respMaxPage is the last page of a response table that can be asked for
+// so the offset of the page is not too big for an int
+const respMaxPage = 1000000
+
+// respTable is a table of the responses page, of a version or of all the
+// versions merged, with the links to sort and page through it
+type respTable struct {
+	models.ResponseSet
+	Answers  int // the number of columns of answers, not version or created
+	Total    int // the number of responses that match the filters
+	From, To int // the numbers of the responses on the page
+	// Browse is if the table has the filter inputs, one table at a time
+	Browse     bool
+	Query      models.ResponseQuery
+	Filters    []string // the filter of each column of answers
+	Sorted     int      // the column the responses are sorted by, from 1
+	SortURLs   []string // the link to sort by each column, blank if not
+	Prev, Next string   // the links to the pages before and after
+	// ShowURL is the link to the table of a version that is not shown,
+	// only the version of the page has its responses read
+	ShowURL string
+}
+
+// findTable is the table of the page of the responses to the form that
+// match the query, the links keep the query of the table in the url
+func (app *application) findTable(id int, q models.ResponseQuery, page int) (respTable, error) {
+	q.Offset, q.Limit = (page-1)*respPageSize, respPageSize
+	versions, total, err := app.response.Find(id, q)
+	if err != nil {
+		return respTable{}, err
+	}
+	t := respTable{Total: total, Query: q, Browse: q.Version != ""}
+	path := "/resp/" + strconv.Itoa(id)
+	values := url.Values{"view": {"merged"}}
+	if q.Version != "" {
+		if len(versions) == 0 {
+			return t, nil // deleted since
+		}
+		t.ResponseSet = versions[0]
+		values = url.Values{"version": {q.Version}}
+		t.Filters = make([]string, len(t.TableHeader)-1)
+		for c := range t.Filters {
+			t.Filters[c] = q.Filters[c+1]
+			if t.Filters[c] != "" {
+				values.Set("f"+strconv.Itoa(c+1), t.Filters[c])
+			}
+		}
+	} else {
+		t.ResponseSet = models.Merge(versions)
+	}
+	t.Answers = len(t.TableHeader) - 1
+	if q.Version == "" {
+		t.Answers-- // and version
+	}
+	if q.Search != "" {
+		values.Set("q", q.Search)
+	}
+	if q.Sort != 0 {
+		values.Set("sort", strconv.Itoa(q.Sort))
+	}
+	if q.Desc {
+		values.Set("desc", "1")
+	}
+
+	// the responses are sorted by created (the last column) if not by
+	// another column, the link of the sorted column reverses it
+	t.Sorted = q.Sort
+	if q.Sort == 0 || q.Version == "" {
+		t.Sorted = len(t.TableHeader)
+	}
+	t.SortURLs = make([]string, len(t.TableHeader))
+	for c := range t.SortURLs {
+		sort := copyValues(values)
+		sort.Del("desc")
+		if t.Sorted == c+1 && !q.Desc {
+			sort.Set("desc", "1")
+		}
+		switch {
+		case q.Version != "":
+			sort.Set("sort", strconv.Itoa(c+1))
+		case c+1 != t.Sorted:
+			continue // all the versions merged can only sort by created
+		}
+		t.SortURLs[c] = path + "?" + sort.Encode()
+	}
+	if len(t.TableData) != 0 {
+		t.From, t.To = q.Offset+1, q.Offset+len(t.TableData)
+	}
+	if page > 1 {
+		prev := copyValues(values)
+		prev.Set("page", strconv.Itoa(page-1))
+		t.Prev = path + "?" + prev.Encode()
+	}
+	if q.Offset+respPageSize < total {
+		next := copyValues(values)
+		next.Set("page", strconv.Itoa(page+1))
+		t.Next = path + "?" + next.Encode()
+	}
+	return t, nil
+}
+
+// viewResp shows the responses a page at a time, a table per version or
+// all the versions merged (?view=merged), or their statistics for all the
+// versions and each version (?view=summary). The table of a version can be
+// sorted and filtered e.g. ?version=2020-12-01+10:00:00&sort=2&desc=1&f1=lam
+// and all the tables searched e.g. ?q=fish
+func (app *application) viewResp(w http.ResponseWriter, r *http.Request) {
+	u := r.Context().Value(contextKey("user")).(models.User)
+	id, _, formItems, ok := app.ownForm(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	q, page, err := responseQuery(query)
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "400 Invalid data", 400)
+		return
+	}
+	versions, err := app.response.Versions(id)
+	if err != nil {
+		app.errorLog.Print(err)
+		http.Error(w, "500 Internal Server Error", 500)
+		return
+	}
+	// ?view=merged is all the versions in one table
+	// ?view=summary is the statistics of the answers
+	merged := query.Get("view") == "merged"
+	summary := query.Get("view") == "summary"
+	numVersions := len(versions)
+
+	var tables []respTable
+	var summaries []models.Summary
+	switch {
+	case numVersions == 0:
+	case summary:
+		// the statistics are of all the responses
+		all, err := app.response.Get(id)
+		if err != nil {
+			app.errorLog.Print(err)
+			http.Error(w, "500 Internal Server Error", 500)
+			return
+		}
+		summaries = models.Summaries(all, formItems)
+	case merged:
+		// only created can be sorted
+		t, err := app.findTable(id, models.ResponseQuery{Desc: q.Desc, Search: q.Search}, page)
+		if err != nil {
+			app.errorLog.Print(err)
+			http.Error(w, "500 Internal Server Error", 500)
+			return
+		}
+		tables = append(tables, t)
+	default:
+		// the query is of one version, the latest if not given
+		if q.Version == "" {
+			q.Version = versions[numVersions-1].Version
+		}
+		found := false
+		for _, v := range versions {
+			if v.Version == q.Version {
+				found = true
+				if q.Sort > len(v.TableHeader) || !validFilters(q.Filters, len(v.TableHeader)-1) {
+					http.Error(w, "400 Invalid data", 400)
+					return
+				}
+			}
+		}
+		if !found {
+			http.Error(w, "404 Version not found", 404)
+			return
+		}
+		for _, v := range versions {
+			if v.Version != q.Version {
+				show := url.Values{"version": {v.Version}}
+				if q.Search != "" {
+					show.Set("q", q.Search)
+				}
+				tables = append(tables, respTable{ResponseSet: v, ShowURL: "/resp/" + strconv.Itoa(id) + "?" + show.Encode()})
+				continue
+			}
+			t, err := app.findTable(id, q, page)
+			if err != nil {
+				app.errorLog.Print(err)
+				http.Error(w, "500 Internal Server Error", 500)
+				return
+			}
+			tables = append(tables, t)
+		}
+	}
+
+	// the query of the page is posted with a delete to come back to it
+	back := copyValues(query)
+	back.Del("back")
+
+	feedback := getFeedback(w, r) // get flash message if any
 	pageData := struct {
-		Versions []models.ResponseSet
+		ID          int
+		Tables      []respTable
+		NumVersions int
+		Merged      bool
+		Summaries   []models.Summary
+		Search      string
+		Words       []string // the words searched for, to highlight
+		Back        string
+		Feedback    string
 		models.User
 		PageMode int
-	}{versions, u, respMode}
+	}{id, tables, numVersions, merged, summaries, q.Search, models.SearchWords(q.Search), back.Encode(), feedback, u, respMode}
 	err = app.tmpl.ExecuteTemplate(w, "form", pageData)
 	if err != nil {
 		app.errorLog.Print(err)
@@ -125,13 +557,36 @@ func (app *application) viewResp(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// backURL is the responses page of the form with the query posted in
+// back, e.g. the version, page, sort and filters the responses were
+// deleted from. A query that is not one of the page is left out
+func backURL(id int, back string) string {
+	path := "/resp/" + strconv.Itoa(id)
+	values, err := url.ParseQuery(back)
+	if err != nil || back == "" {
+		return path
+	}
+	if _, _, err = responseQuery(values); err != nil {
+		return path
+	}
+	return path + "?" + values.Encode()
+}
+
+// delResp deletes a response (del<id>), the selected responses (sel)
+// or all the responses to a version (ver<n>, the nth version)
 func (app *application) delResp(w http.ResponseWriter, r *http.Request) {
 	action := r.FormValue("action")
-	var id int
+	var n int
 	var err error
 
-	if !stringIs(action, "choose", "auth") {
-		action, id, err = getAction(action)
+	// the version to delete is posted, not its place in the list which
+	// can change before the button is clicked
+	version, ok := strings.CutPrefix(action, "ver ")
+	if ok {
+		action = "ver"
+	}
+	if !stringIs(action, "choose", "auth", "sel", "ver") {
+		action, n, err = getAction(action)
 		if err != nil {
 			app.errorLog.Print(err)
 			http.Error(w, "400 Invalid data", 400)
@@ -142,14 +597,84 @@ func (app *application) delResp(w http.ResponseWriter, r *http.Request) {
 	u := r.Context().Value(contextKey("user")).(models.User)
 
 	switch action {
-	case "del":
-		_ = id
-		// err = app.form.Delete(id, u.ID)
-		// if err != nil {
-		// 	app.errorLog.Print(err)
-		// 	http.Error(w, "500 Internal Server Error", 500)
-		// 	return
-		// }
+	case "del", "sel", "ver":
+		// demo mode does not save changes
+		if u.ID == 0 {
+			http.Redirect(w, r, "/login", 303)
+			return
+		}
+		id, err := strconv.Atoi(httprouter.ParamsFromContext(r.Context()).ByName("id"))
+		if err != nil {
+			app.errorLog.Print(err)
+			http.Error(w, "400 Invalid data", 400)
+			return
+		}
+		ok, err := app.form.Check(id, u.ID)
+		if err != nil {
+			app.errorLog.Print(err)
+			http.Error(w, "500 Internal Server Error", 500)
+			return
+		}
+		if !ok {
+			app.errorLog.Printf("form id:%v user:%v not found", id, u.Name)
+			http.Error(w, "404 Form not found", 404)
+			return
+		}
+		// the versions have the files of the responses to delete
+		versions, err := app.response.Get(id)
+		if err != nil {
+			app.errorLog.Print(err)
+			http.Error(w, "500 Internal Server Error", 500)
+			return
+		}
+		var keys []string
+		switch action {
+		case "ver":
+			found := false
+			for _, v := range versions {
+				if v.Version == version {
+					found = true
+					var ids []int
+					for _, r := range v.TableData {
+						ids = append(ids, r.ID)
+					}
+					keys = fileKeys(v, ids)
+				}
+			}
+			if !found {
+				http.Error(w, "404 Version not found", 404)
+				return
+			}
+			err = app.response.DeleteVersion(id, version)
+		default:
+			ids := []int{n}
+			if action == "sel" {
+				ids, err = formInts(r, "sel")
+				if err != nil {
+					app.errorLog.Print(err)
+					http.Error(w, "400 Invalid data", 400)
+					return
+				}
+				if len(ids) == 0 {
+					setFeedback(w, "No responses ticked")
+					http.Redirect(w, r, backURL(id, r.PostFormValue("back")), 303)
+					return
+				}
+			}
+			for _, v := range versions {
+				keys = append(keys, fileKeys(v, ids)...)
+			}
+			err = app.response.Delete(id, ids)
+		}
+		if err != nil {
+			app.errorLog.Print(err)
+			http.Error(w, "500 Internal Server Error", 500)
+			return
+		}
+		app.deleteFiles(keys)
+		setFeedback(w, "Responses deleted")
+		http.Redirect(w, r, backURL(id, r.PostFormValue("back")), 303)
+		return
 	case "choose":
 		http.Redirect(w, r, "/edit", 303)
 		return
@@ -25,6 +25,12 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc("GET", "/resp/:id", app.auth(app.viewResp))
 	router.HandlerFunc("POST", "/resp/:id", app.auth(app.delResp))
+	router.HandlerFunc("GET", "/resp/:id/export", app.auth(app.exportResp))
+	router.HandlerFunc("GET", "/resp/:id/chart", app.auth(app.chartResp))
+	router.HandlerFunc("GET", "/file/:id/:uuid/:name", app.auth(app.getFile))
+
+	router.HandlerFunc("GET", "/hist/:id", app.auth(app.viewHist))
+	router.HandlerFunc("POST", "/hist/:id", app.auth(app.restoreRev))
 
 	router.HandlerFunc("GET", "/login", app.login)
 	router.HandlerFunc("POST", "/login", app.login)
@@ -1,26 +1,168 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"forms/models"
 	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"regexp"
 	"strconv"
 	"strings"
+	"testing"
 
 	"golang.org/x/net/html"
 )
 
+// newTestApp is the app from init() using the in memory store
+// with the demo forms, like running the server with -demo
+func newTestApp(t *testing.T) *application {
+	store, err := models.Open("memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = addDemoForms(store.Form); err != nil {
+		t.Fatal(err)
+	}
+	a := app
+	a.user, a.form, a.response = store.User, store.Form, store.Response
+	a.files = models.NewMemFiles()
+	a.uploads = newUploads()
+	a.session = session{sid: map[string]models.User{}, uid: map[int]string{}}
+	return &a
+}
+
+// testClient is a browser (keeps cookies) for end to end tests
+// of a test server made with newTestApp, the app is to seed its stores
+type testClient struct {
+	t      *testing.T
+	client *http.Client
+	url    string
+	app    *application
+}
+
+func newTestClient(t *testing.T) testClient {
+	a := newTestApp(t)
+	ts := httptest.NewServer(a.routes())
+	t.Cleanup(ts.Close)
+	jar, _ := cookiejar.New(nil)
+	return testClient{t, &http.Client{Jar: jar}, ts.URL, a}
+}
+
+// newFormClient is a test client signed up as lam with a new form, 4 after
+// the demo forms, saved from the form values with action view if there are
+// any. The ids are of the saved form items
+func newFormClient(t *testing.T, form url.Values) (c testClient, ids []string) {
+	t.Helper()
+	c = newTestClient(t)
+	c.post("/signup", url.Values{"username": {"lam"}, "password": {"secret"}})
+	c.post("/edit", url.Values{"action": {"add"}})
+	if form == nil {
+		return c, nil
+	}
+	form.Set("action", "view")
+	return c, itemIDs(c.post("/edit/4", form))
+}
+
+// signup is another browser of the same test server signed up as the user
+func (c testClient) signup(username string) testClient {
+	jar, _ := cookiejar.New(nil)
+	other := testClient{c.t, &http.Client{Jar: jar}, c.url, c.app}
+	other.post("/signup", url.Values{"username": {username}, "password": {"secret"}})
+	return other
+}
+
+// formVersion is the version of the form in the hidden input of a use page
+func formVersion(t *testing.T, body string) string {
+	t.Helper()
+	m := regexp.MustCompile(`name="version" value="([^"]*)"`).FindStringSubmatch(body)
+	if m == nil {
+		t.Fatalf("no version in use form:\n%s", body)
+	}
+	return m[1]
+}
+
+// post the form and return the body of the page (after redirects)
+func (c testClient) post(path string, form url.Values) string {
+	r, err := c.client.PostForm(c.url+path, form)
+	return c.body("POST "+path, r, err)
+}
+
+// upload is a file in a multipart form
+type upload struct {
+	field, filename, contentType, content string
+}
+
+// postFiles posts the form and files as multipart/form-data
+// and returns the body of the page (after redirects)
+func (c testClient) postFiles(path string, form url.Values, files ...upload) string {
+	c.t.Helper()
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	for key, values := range form {
+		for _, value := range values {
+			mw.WriteField(key, value)
+		}
+	}
+	for _, f := range files {
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, f.field, f.filename))
+		h.Set("Content-Type", f.contentType)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		io.WriteString(part, f.content)
+	}
+	mw.Close()
+	r, err := c.client.Post(c.url+path, mw.FormDataContentType(), &b)
+	return c.body("POST "+path, r, err)
+}
+
+// get the body of the page
+func (c testClient) get(path string) string {
+	r, err := c.client.Get(c.url + path)
+	return c.body("GET "+path, r, err)
+}
+
+func (c testClient) body(request string, r *http.Response, err error) string {
+	c.t.Helper()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer r.Body.Close()
+	b, _ := ioutil.ReadAll(r.Body)
+	if r.StatusCode != 200 {
+		c.t.Fatalf("%s: %d %s", request, r.StatusCode, b)
+	}
+	return string(b)
+}
+
+// itemIDs are the form item ids in the hidden id inputs of an edit
+// or preview page, the names of the answers on the use page
+func itemIDs(body string) (ids []string) {
+	for _, m := range regexp.MustCompile(`name="id" value="([^"]*)"`).FindAllStringSubmatch(body, -1) {
+		ids = append(ids, m[1])
+	}
+	return ids
+}
+
 // makePostBody strings together a form request body e.g key=value&key=value&....
 func makePostBody(data pageData, action string) io.Reader {
 	body := "action=" + action + "&title=" + data.Title
 	for index, formItem := range data.FormItems {
 		body = body + "&label=" + formItem.Label
-		if formItem.Type == "select" {
-			body = body + "&type=select"
+		body = body + "&type=" + formItem.Type
+		if hasOptions(formItem.Type) {
 			for _, option := range formItem.Options {
 				body = body + "&options" + strconv.Itoa(index) + "=" + option
 			}
-		} else {
-			body = body + "&type=" + formItem.Type
 		}
 	}
 	return strings.NewReader(body)
@@ -123,7 +265,7 @@ func scrapeViewForm(body io.Reader) pageData {
 						break
 					}
 				}
-				if fI.Type == "select" {
+				if hasOptions(fI.Type) {
 					for {
 						t = getNextToken(z)
 						if z.Err() != nil {
@@ -147,16 +289,39 @@ func scrapeViewForm(body io.Reader) pageData {
 				continue
 			}
 			fI.Label = t.Data
-			// look for next <select> or <input> for input type
+			// look for next <select>, <fieldset>, <textarea>, <input> or <hr> for input type
 			for {
 				t = getNextToken(z)
 				if z.Err() != nil {
 					break
 				}
-				if t.Type == html.StartTagToken && (t.Data == "select" || t.Data == "input") {
+				if t.Type == html.StartTagToken && stringIs(t.Data, "select", "fieldset", "textarea", "input", "hr") {
 					break
 				}
 			}
+			if t.Data == "textarea" {
+				fI.Type = t.Data
+			}
+			// a section is a page break <hr>
+			if t.Data == "hr" {
+				fI.Type = "section"
+			}
+			// <fieldset> of radio or checkbox <input>s, one per option
+			if t.Data == "fieldset" {
+				for {
+					t = getNextToken(z)
+					if z.Err() != nil || t.Type == html.EndTagToken && t.Data == "fieldset" {
+						break
+					}
+					if t.Type == html.StartTagToken && t.Data == "input" {
+						fI.Type = "radio"
+						if getAttr(t, "type") == "checkbox" {
+							fI.Type = "checkboxes"
+						}
+						fI.Options = append(fI.Options, getAttr(t, "value"))
+					}
+				}
+			}
 			// <select> is followed by <option>s
 			if t.Data == "select" {
 				fI.Type = t.Data
@@ -252,8 +417,8 @@ func scrapeEditForm(body io.Reader) pageData {
 					}
 				}
 			}
-			// <input name="type" value="select">
-			if fI.Type == "select" {
+			// <input name="type" value="select|radio|checkboxes">
+			if hasOptions(fI.Type) {
 				fI.Options = []string{}
 				for { // look for next <input name=optionsX>
 					t = getNextToken(z)
@@ -301,3 +466,9 @@ func (m mockDB) Use(id int) (title, updated string, formItems []models.FormItem,
 func (m mockDB) Check(id, userid int) (bool, error) {
 	return true, nil
 }
+func (m mockDB) Revisions(id, userid int) (revisions []models.Revision, err error) {
+	return
+}
+func (m mockDB) Revision(id, userid, rev int) (revision models.Revision, found bool, err error) {
+	return
+}
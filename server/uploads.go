@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"mime/multipart"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// uploadExpiry is how long the files uploaded to a response that is not
+// sent are kept, maxPending is the most of these files kept at a time
+const (
+	uploadExpiry = time.Hour
+	maxPending   = 1000
+)
+
+// errTooManyUploads is when maxPending files wait for their responses
+var errTooManyUploads = errors.New("too many files uploaded to responses not sent")
+
+// uploads are the files uploaded to responses that are not sent yet. A
+// file is saved when it is uploaded so it is not uploaded again if other
+// answers are wrong or on the next pages. The response being filled in
+// has a random token in a hidden input, only the files uploaded with the
+// token can be sent with it. The files of responses that are never sent
+// are deleted after uploadExpiry, or left behind if the server stops
+type uploads struct {
+	mu      sync.Mutex
+	pending map[string]pendingUpload // by file key
+}
+
+// pendingUpload is a file uploaded to a form item of a response not sent
+type pendingUpload struct {
+	token   string
+	formID  int
+	itemID  string
+	name    string
+	sum     [sha256.Size]byte // the same file uploaded again is not saved
+	expires time.Time
+}
+
+func newUploads() *uploads {
+	return &uploads{pending: map[string]pendingUpload{}}
+}
+
+// uploadToken is the token of the response being filled in posted by the
+// use page, blank if there is none or it is not a token
+func uploadToken(value string) string {
+	if _, err := uuid.Parse(value); err != nil {
+		return ""
+	}
+	return value
+}
+
+// saveUpload saves the file uploaded to the form item of the response with
+// token and returns its key, or the key of the same file uploaded before.
+// The file it replaces is deleted
+func (app *application) saveUpload(token string, formID int, itemID string, file *multipart.FileHeader) (string, error) {
+	sum, err := fileSum(file)
+	if err != nil {
+		return "", err
+	}
+	u := app.uploads
+	u.mu.Lock()
+	expired := u.expire(time.Now())
+	key, replaced := "", ""
+	for k, p := range u.pending {
+		if p.token != token || p.formID != formID || p.itemID != itemID {
+			continue
+		}
+		if p.name == file.Filename && p.sum == sum {
+			key = k
+		} else {
+			replaced = k
+		}
+	}
+	full := len(u.pending) >= maxPending
+	u.mu.Unlock()
+	app.deleteFiles(expired)
+	if key != "" {
+		return key, nil
+	}
+	if full {
+		return "", errTooManyUploads
+	}
+
+	if key, err = app.saveFile(formID, file); err != nil {
+		return "", err
+	}
+	u.mu.Lock()
+	u.pending[key] = pendingUpload{token, formID, itemID, file.Filename, sum, time.Now().Add(uploadExpiry)}
+	if replaced != "" {
+		delete(u.pending, replaced)
+	}
+	u.mu.Unlock()
+	if replaced != "" {
+		app.deleteFiles([]string{replaced})
+	}
+	return key, nil
+}
+
+// uploaded is if key is a file uploaded to the form item of the response
+// with token and not sent, and it is still there
+func (app *application) uploaded(token string, formID int, itemID, key string) bool {
+	app.uploads.mu.Lock()
+	p, ok := app.uploads.pending[key]
+	app.uploads.mu.Unlock()
+	if !ok || token == "" || p.token != token || p.formID != formID || p.itemID != itemID || time.Now().After(p.expires) {
+		return false
+	}
+	f, err := app.files.Get(key)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// sendUploads takes the files with keys uploaded to the response with
+// token for the response to be saved with, false if one of them is not
+// pending e.g. the response was sent already. The other files uploaded to
+// it e.g. to an item hidden later are deleted
+func (app *application) sendUploads(token string, keys []string) bool {
+	u := app.uploads
+	u.mu.Lock()
+	for _, key := range keys {
+		if p, ok := u.pending[key]; !ok || p.token != token {
+			u.mu.Unlock()
+			return false
+		}
+	}
+	var unsent []string
+	for k, p := range u.pending {
+		if p.token != token {
+			continue
+		}
+		delete(u.pending, k)
+		if !stringIs(k, keys...) {
+			unsent = append(unsent, k)
+		}
+	}
+	u.mu.Unlock()
+	app.deleteFiles(unsent)
+	return true
+}
+
+// expire forgets the files uploaded to responses not sent by now and
+// returns their keys to delete them, the caller has the lock
+func (u *uploads) expire(now time.Time) (keys []string) {
+	for k, p := range u.pending {
+		if now.After(p.expires) {
+			delete(u.pending, k)
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// fileSum is the sha256 of the content of the uploaded file
+func fileSum(file *multipart.FileHeader) (sum [sha256.Size]byte, err error) {
+	f, err := file.Open()
+	if err != nil {
+		return sum, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return sum, err
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"mime/multipart"
+	"testing"
+	"time"
+)
+
+// uploadedFile is the file as it is uploaded in a multipart form
+func uploadedFile(t *testing.T, name, content string) *multipart.FileHeader {
+	t.Helper()
+	var b bytes.Buffer
+	mw := multipart.NewWriter(&b)
+	part, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	mw.Close()
+	form, err := multipart.NewReader(&b, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.File["file"][0]
+}
+
+func TestSaveUpload(t *testing.T) {
+	a := newTestApp(t)
+	const token, other = "6ba7b810-9dad-41d1-80b4-00c04fd430c8", "6ba7b811-9dad-41d1-80b4-00c04fd430c8"
+	exists := func(key string) bool {
+		f, err := a.files.Get(key)
+		if err == nil {
+			f.Close()
+		}
+		return !errors.Is(err, fs.ErrNotExist)
+	}
+
+	key, err := a.saveUpload(token, 4, "item", uploadedFile(t, "cv.pdf", "%PDF-1"))
+	if err != nil || !exists(key) {
+		t.Fatalf("not saved: %s %v", key, err)
+	}
+	if again, _ := a.saveUpload(token, 4, "item", uploadedFile(t, "cv.pdf", "%PDF-1")); again != key {
+		t.Errorf("the same file saved again as %s", again)
+	}
+	replaced := key
+	if key, _ = a.saveUpload(token, 4, "item", uploadedFile(t, "cv.pdf", "%PDF-2")); key == replaced || exists(replaced) {
+		t.Errorf("replaced file %s not deleted, new %s", replaced, key)
+	}
+
+	for _, tc := range []struct {
+		name, token, item string
+		formID            int
+		want              bool
+	}{
+		{"uploaded", token, "item", 4, true},
+		{"other response", other, "item", 4, false},
+		{"no token", "", "item", 4, false},
+		{"other item", token, "other", 4, false},
+		{"other form", token, "item", 5, false},
+	} {
+		if got := a.uploaded(tc.token, tc.formID, tc.item, key); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// the files of responses not sent expire and are deleted by the next upload
+	a.uploads.mu.Lock()
+	p := a.uploads.pending[key]
+	p.expires = time.Now().Add(-time.Second)
+	a.uploads.pending[key] = p
+	a.uploads.mu.Unlock()
+	if a.uploaded(token, 4, "item", key) {
+		t.Error("expired file uploaded")
+	}
+	otherKey, _ := a.saveUpload(other, 4, "item", uploadedFile(t, "menu.pdf", "%PDF"))
+	if exists(key) || !exists(otherKey) {
+		t.Errorf("expired file %s not deleted", key)
+	}
+
+	// a file uploaded to an item hidden when the response is sent is deleted
+	hidden, _ := a.saveUpload(other, 4, "hidden", uploadedFile(t, "photo.png", "PNG"))
+	if !a.sendUploads(other, []string{otherKey}) || !exists(otherKey) || exists(hidden) || a.uploaded(other, 4, "item", otherKey) {
+		t.Errorf("after sent: %v %v", exists(otherKey), exists(hidden))
+	}
+	if a.sendUploads(other, []string{otherKey}) {
+		t.Error("file sent with two responses")
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"forms/models"
+)
+
+// an xlsx file is a zip of xml parts (office open xml), the parts here are
+// the least a spreadsheet app needs: the workbook, its worksheets and the
+// styles of the header and date cells. Strings are written inline in their
+// cells so there is no shared strings part
+
+// the cell styles, by their index in cellXfs of xlsxStyles
+const (
+	styleHeader = iota + 1
+	styleDate
+	styleTime
+	styleTimeSeconds
+	styleDateTime
+	styleWrap
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="4"><numFmt numFmtId="164" formatCode="yyyy-mm-dd"/><numFmt numFmtId="165" formatCode="hh:mm"/><numFmt numFmtId="166" formatCode="hh:mm:ss"/><numFmt numFmtId="167" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="7"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="166" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="167" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0" applyAlignment="1"><alignment vertical="top" wrapText="1"/></xf></cellXfs>
+</styleSheet>`
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+%s</Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+// xlsxCell is a cell of a worksheet, t is its type (n number, b boolean,
+// inlineStr text) and s its style, a blank cell is not written
+type xlsxCell struct {
+	t, value string
+	s        int
+}
+
+// excelEpoch is day 0 of the dates in a spreadsheet
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// excelTime is t as days since excelEpoch
+func excelTime(t time.Time) string {
+	return models.FormatNumber(float64(t.Unix()-excelEpoch.Unix()) / (24 * 60 * 60))
+}
+
+// newXLSXCell is the cell of an answer to a form item of inputType, typed
+// if it is one value of a number, date, time or checkbox item
+func newXLSXCell(inputType string, answer models.Answer, file bool) xlsxCell {
+	value := answer.String()
+	if file && value != "" {
+		value = fileURLs(answer)
+	}
+	if len(answer) <= 1 {
+		switch inputType {
+		case "number":
+			// NaN, Inf and hex numbers are not numbers of a cell
+			if f, ok := parseNumber(value); ok {
+				return xlsxCell{"n", models.FormatNumber(f), 0}
+			}
+		case "date":
+			if d, err := time.Parse("2006-01-02", value); err == nil {
+				return xlsxCell{"n", excelTime(d), styleDate}
+			}
+		case "time":
+			if t, err := time.Parse("15:04", value); err == nil {
+				return xlsxCell{"n", excelTime(t.AddDate(1899, 11, 29)), styleTime}
+			}
+			if t, err := time.Parse("15:04:05", value); err == nil {
+				return xlsxCell{"n", excelTime(t.AddDate(1899, 11, 29)), styleTimeSeconds}
+			}
+		case "created":
+			if t, err := time.Parse("2006-01-02 15:04:05", value); err == nil {
+				return xlsxCell{"n", excelTime(t), styleDateTime}
+			}
+		case "checkbox":
+			switch value {
+			case "✅":
+				return xlsxCell{"b", "1", 0}
+			case "":
+				return xlsxCell{"b", "0", 0}
+			}
+		}
+	}
+	if strings.Contains(value, "\n") {
+		return xlsxCell{"inlineStr", value, styleWrap}
+	}
+	return xlsxCell{"inlineStr", value, 0}
+}
+
+// xlsxColumn is the column letters of column i (from 0) e.g. A, Z, AA
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxSheetNames are the names of the worksheets of the versions, a name
+// cannot have []:*?/\ and is at most 31 characters
+func xlsxSheetNames(versions []models.ResponseSet) []string {
+	names := make([]string, len(versions))
+	for i, v := range versions {
+		names[i] = strings.NewReplacer(":", ".", "/", "-", "\\", "-", "[", "(", "]", ")", "*", "_", "?", "_").Replace(v.Version)
+		if utf8.RuneCountInString(names[i]) > 31 {
+			names[i] = string([]rune(names[i])[:31])
+		}
+	}
+	if len(names) == 0 {
+		names = append(names, "Responses") // a workbook has at least one sheet
+	}
+	return names
+}
+
+// writeXLSX writes the responses as an xlsx workbook with a worksheet for
+// each version, the header row is bold and the columns are as wide as
+// their longest line
+func writeXLSX(w io.Writer, versions []models.ResponseSet) error {
+	zw := zip.NewWriter(w)
+	names := xlsxSheetNames(versions)
+
+	var overrides, sheets, rels strings.Builder
+	for i, name := range names {
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", i+1)
+		fmt.Fprintf(&sheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(name), i+1, i+1)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", i+1, i+1)
+	}
+	fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+"\n", len(names)+1)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", fmt.Sprintf(xlsxContentTypes, overrides.String())},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+` + rels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err = io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+
+	if len(versions) == 0 {
+		versions = []models.ResponseSet{{}}
+	}
+	for i, set := range versions {
+		f, err := zw.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1))
+		if err != nil {
+			return err
+		}
+		if err = writeXLSXSheet(f, set); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeXLSXSheet writes the worksheet of a version, a row at a time
+func writeXLSXSheet(w io.Writer, set models.ResponseSet) error {
+	types := make([]string, len(set.TableHeader))
+	copy(types, set.Types)
+	if len(types) > 0 {
+		types[len(types)-1] = "created"
+	}
+	header := make([]xlsxCell, len(set.TableHeader))
+	widths := make([]int, len(set.TableHeader))
+	for i, key := range set.TableHeader {
+		header[i] = xlsxCell{"inlineStr", key, styleHeader}
+		widths[i] = max(widths[i], textWidth(key))
+	}
+	rows := make([][]xlsxCell, len(set.TableData))
+	for n, r := range set.TableData {
+		rows[n] = make([]xlsxCell, len(r.Data))
+		for i, answer := range r.Data {
+			if i >= len(types) {
+				break
+			}
+			rows[n][i] = newXLSXCell(types[i], answer, set.IsFile(i))
+			width := textWidth(rows[n][i].value)
+			switch rows[n][i].s {
+			case styleDate, styleTime, styleTimeSeconds, styleDateTime:
+				width = textWidth(answer.String()) // the formatted width
+			}
+			widths[i] = max(widths[i], width)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if len(header) > 0 {
+		b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews><cols>`)
+		for i, width := range widths {
+			// a character is about one unit wide, with room for the padding
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, min(max(width, 8), 60)+2)
+		}
+		b.WriteString(`</cols>`)
+	}
+	b.WriteString(`<sheetData>`)
+	if len(header) > 0 {
+		writeXLSXRow(&b, 1, header)
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	for n, row := range rows {
+		b.Reset()
+		writeXLSXRow(&b, n+2, row)
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, `</sheetData></worksheet>`)
+	return err
+}
+
+// writeXLSXRow writes the cells of row number n (from 1)
+func writeXLSXRow(b *strings.Builder, n int, cells []xlsxCell) {
+	fmt.Fprintf(b, `<row r="%d">`, n)
+	for i, c := range cells {
+		if c.t == "" || c.t == "inlineStr" && c.value == "" {
+			continue
+		}
+		fmt.Fprintf(b, `<c r="%s%d"`, xlsxColumn(i), n)
+		if c.s != 0 {
+			fmt.Fprintf(b, ` s="%d"`, c.s)
+		}
+		if c.t == "inlineStr" {
+			fmt.Fprintf(b, ` t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, xmlEscape(c.value))
+			continue
+		}
+		if c.t == "b" {
+			b.WriteString(` t="b"`)
+		}
+		fmt.Fprintf(b, `><v>%s</v></c>`, c.value)
+	}
+	b.WriteString(`</row>`)
+}
+
+// textWidth is the length of the longest line of the text
+func textWidth(text string) int {
+	width := 0
+	for _, line := range strings.Split(text, "\n") {
+		width = max(width, utf8.RuneCountInString(line))
+	}
+	return width
+}
+
+// xmlEscape is the text escaped for xml, the characters not allowed in xml
+// are replaced by �
+func xmlEscape(text string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
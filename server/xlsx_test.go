@@ -0,0 +1,131 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"forms/models"
+)
+
+// readXLSX is the text of the parts of an xlsx file by name
+func readXLSX(t *testing.T, b []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = xml.Unmarshal(content, new(struct{})); err != nil {
+			t.Errorf("%s is not xml: %v", f.Name, err)
+		}
+		parts[f.Name] = string(content)
+	}
+	return parts
+}
+
+func TestWriteXLSX(t *testing.T) {
+	versions := []models.ResponseSet{
+		{
+			Version:     "2020-12-01 10:00:00",
+			TableHeader: []string{"Name", "created"},
+			Types:       []string{"text"},
+			TableData:   []models.Response{{Data: []models.Answer{{"Lam <Tan> & co"}, {"2020-12-01 12:00:00"}}}},
+		},
+		{
+			Version:     "2020-12-02 10:00:00",
+			TableHeader: []string{"Name", "Qty", "Date", "Time", "Chilli", "Sides", "CV", "created"},
+			Types:       []string{"text", "number", "date", "time", "checkbox", "checkboxes", "file"},
+			TableData: []models.Response{
+				{Data: []models.Answer{{"Tan"}, {"2.5"}, {"2020-12-25"}, {"18:30"}, {"✅"}, {"Rice", "Fries"}, {"4/u/cv 100%.pdf"}, {"2020-12-02 12:00:00"}}},
+				{Data: []models.Answer{{""}, {"lots"}, {""}, {""}, {""}, nil, {""}, {"2020-12-03 06:00:00"}}},
+			},
+		},
+	}
+	var b bytes.Buffer
+	if err := writeXLSX(&b, versions); err != nil {
+		t.Fatal(err)
+	}
+	parts := readXLSX(t, b.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("no %s", name)
+		}
+	}
+	if !strings.Contains(parts["xl/workbook.xml"], `<sheet name="2020-12-02 10.00.00" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("workbook: %s", parts["xl/workbook.xml"])
+	}
+	for _, want := range []string{
+		`<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">Name</t></is></c>`,
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">Lam &lt;Tan&gt; &amp; co</t></is></c>`,
+		`<c r="B2" s="5"><v>44166.5</v></c>`,
+	} {
+		if !strings.Contains(parts["xl/worksheets/sheet1.xml"], want) {
+			t.Errorf("sheet1 has no %s:\n%s", want, parts["xl/worksheets/sheet1.xml"])
+		}
+	}
+	for _, want := range []string{
+		`<col min="1" max="1" width="10" customWidth="1"/>`,
+		`<c r="B2"><v>2.5</v></c>`,
+		`<c r="C2" s="2"><v>44190</v></c>`,
+		`<c r="D2" s="3"><v>0.7708333333333334</v></c>`,
+		`<c r="E2" t="b"><v>1</v></c>`,
+		`<c r="F2" s="6" t="inlineStr"><is><t xml:space="preserve">Rice&#xA;Fries</t></is></c>`,
+		`<c r="G2" t="inlineStr"><is><t xml:space="preserve">/file/4/u/cv%20100%25.pdf</t></is></c>`,
+		`<row r="3"><c r="B3" t="inlineStr"><is><t xml:space="preserve">lots</t></is></c><c r="E3" t="b"><v>0</v></c><c r="H3" s="5"><v>44168.25</v></c></row>`,
+	} {
+		if !strings.Contains(parts["xl/worksheets/sheet2.xml"], want) {
+			t.Errorf("sheet2 has no %s:\n%s", want, parts["xl/worksheets/sheet2.xml"])
+		}
+	}
+
+	b.Reset()
+	if err := writeXLSX(&b, nil); err != nil {
+		t.Fatal(err)
+	}
+	if parts = readXLSX(t, b.Bytes()); !strings.Contains(parts["xl/workbook.xml"], `<sheet name="Responses"`) {
+		t.Errorf("no responses: %v", parts)
+	}
+}
+
+// TestXLSXNumberCell writes the answers to a number item that are not
+// finite decimal numbers as text, a spreadsheet app cannot open a workbook
+// with them in a number cell
+func TestXLSXNumberCell(t *testing.T) {
+	for value, want := range map[string]xlsxCell{
+		"2.5":   {"n", "2.5", 0},
+		"-1e3":  {"n", "-1000", 0},
+		"NaN":   {"inlineStr", "NaN", 0},
+		"+Inf":  {"inlineStr", "+Inf", 0},
+		"1e400": {"inlineStr", "1e400", 0},
+		"0x1p4": {"inlineStr", "0x1p4", 0},
+	} {
+		if got := newXLSXCell("number", models.Answer{value}, false); got != want {
+			t.Errorf("%s: got %+v, want %+v", value, got, want)
+		}
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	var got []string
+	for _, i := range []int{0, 25, 26, 51, 52, 701, 702} {
+		got = append(got, xlsxColumn(i))
+	}
+	if want := []string{"A", "Z", "AA", "AZ", "BA", "ZZ", "AAA"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}